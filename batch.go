@@ -0,0 +1,90 @@
+package stackrus
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// batchSyncConcurrency bounds the synchronous writes FireBatch runs at once.
+const batchSyncConcurrency = 8
+
+// FireBatch sends entries as Fire would, e.g. from a tool importing
+// historical records, but builds them all from a single copy of the hook's
+// configuration. Entries sent asynchronously are handed to the logger's buffer
+// in order; synchronous writes run concurrently, at most
+// batchSyncConcurrency at a time. Entries at levels the hook doesn't fire
+// for are skipped, and filtering and sampling apply to each entry. FireBatch
+// returns the first write error, after attempting every entry. Unlike Fire,
+// it doesn't flush before Fatal and Panic entries, since logrus doesn't exit
+// after a batch.
+func (h *Hook) FireBatch(entries []*logrus.Entry) error {
+	if h.discard || h.muted(uint64(len(entries))) {
+		return nil
+	}
+	type batchEntry struct {
+		e      *logrus.Entry
+		entry  logging.Entry
+		logID  string
+		logger EntryLogger
+		sync   bool
+	}
+	b := h.builder()
+	batch := make([]batchEntry, 0, len(entries))
+	for _, e := range entries {
+		if !b.hasLevel(e.Level) || !b.shouldSend(e) {
+			continue
+		}
+		entry, logID, err := b.buildEntry(e)
+		if err != nil {
+			atomic.AddUint64(&h.counters.dropped, 1)
+			b.report(err)
+			continue
+		}
+		batch = append(batch, batchEntry{e, entry, logID, b.loggerFor(logID), b.sendsSync(e.Level)})
+	}
+	syncs, mirrors, flushEveryN := b.syncSettings(), b.mirrors, b.flushEveryN
+	b.reportErrors()
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, batchSyncConcurrency)
+	for _, be := range batch {
+		if h.writeDryRun(be.entry, be.logID) {
+			continue
+		}
+		mirror(mirrors, be.entry)
+		if !be.sync {
+			be.logger.Log(be.entry)
+			atomic.AddUint64(&h.counters.sent, 1)
+			h.countEnqueued(flushEveryN)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(be batchEntry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := syncs.logSync(be.logger, be.entry); err != nil {
+				atomic.AddUint64(&h.counters.failed, 1)
+				h.writeFallback(be.e)
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+				return
+			}
+			atomic.AddUint64(&h.counters.sent, 1)
+		}(be)
+	}
+	wg.Wait()
+	return firstErr
+}
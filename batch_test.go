@@ -0,0 +1,42 @@
+package stackrus
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFireBatchCountsEnqueued(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetFlushEveryN(2)
+
+	entries := make([]*logrus.Entry, 3)
+	for i := range entries {
+		entries[i] = &logrus.Entry{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel, Message: "batched"}
+	}
+	if err := h.FireBatch(entries); err != nil {
+		t.Fatalf("FireBatch: %v", err)
+	}
+	if got := atomic.LoadUint64(&h.counters.enqueued); got != 3 {
+		t.Errorf("enqueued = %d, want 3", got)
+	}
+}
+
+func TestFireBatchHonorsLevels(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetLevels(logrus.ErrorLevel)
+	entries := []*logrus.Entry{
+		{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel, Message: "skipped"},
+		{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.ErrorLevel, Message: "sent"},
+	}
+	if err := h.FireBatch(entries); err != nil {
+		t.Fatalf("FireBatch: %v", err)
+	}
+	if len(l.entries) != 1 {
+		t.Fatalf("got %d entries, want only the Error entry", len(l.entries))
+	}
+}
@@ -0,0 +1,66 @@
+package stackrus
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// Reserved label keys set by SetBuildInfo.
+const (
+	versionLabel = "version"
+	commitLabel  = "commit"
+)
+
+// SetBuildInfo adds version and commit labels to every entry, e.g. from
+// values injected with -ldflags. Empty values are read from the binary's
+// build information when available: the main module's version, and the VCS
+// revision stamped by go build or else the commit of a pseudo-version such as
+// v0.0.0-20210101000000-abcdef123456.
+// Labels promoted from entry fields don't override them.
+func (h *Hook) SetBuildInfo(version, commit string) {
+	if version == "" || commit == "" {
+		v, c := readBuildInfo()
+		if version == "" {
+			version = v
+		}
+		if commit == "" {
+			commit = c
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buildLabels = make(map[string]string, 2)
+	if version != "" {
+		h.buildLabels[versionLabel] = version
+	}
+	if commit != "" {
+		h.buildLabels[commitLabel] = commit
+	}
+}
+
+// readBuildInfo returns the version and commit of the main module.
+func readBuildInfo() (version, commit string) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+	return parseBuildInfo(bi)
+}
+
+func parseBuildInfo(bi *debug.BuildInfo) (version, commit string) {
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			commit = s.Value
+		}
+	}
+	if bi.Main.Version == "" || bi.Main.Version == "(devel)" {
+		return "", commit
+	}
+	version = bi.Main.Version
+	parts := strings.Split(strings.TrimSuffix(version, "+incompatible"), "-")
+	if last := parts[len(parts)-1]; commit == "" && len(parts) >= 3 && len(last) == 12 && isHex(last) {
+		commit = last
+	}
+	return version, commit
+}
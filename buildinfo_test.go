@@ -0,0 +1,29 @@
+package stackrus
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestParseBuildInfo(t *testing.T) {
+	const revision = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name        string
+		version     string
+		settings    []debug.BuildSetting
+		wantVersion string
+		wantCommit  string
+	}{
+		{"devel with revision", "(devel)", []debug.BuildSetting{{Key: "vcs.revision", Value: revision}}, "", revision},
+		{"release", "v1.2.3", nil, "v1.2.3", ""},
+		{"pseudo-version", "v0.0.0-20210101000000-abcdef123456", nil, "v0.0.0-20210101000000-abcdef123456", "abcdef123456"},
+		{"revision over pseudo-version", "v0.0.0-20210101000000-abcdef123456", []debug.BuildSetting{{Key: "vcs.revision", Value: revision}}, "v0.0.0-20210101000000-abcdef123456", revision},
+	}
+	for _, tt := range tests {
+		bi := &debug.BuildInfo{Main: debug.Module{Version: tt.version}, Settings: tt.settings}
+		version, commit := parseBuildInfo(bi)
+		if version != tt.wantVersion || commit != tt.wantCommit {
+			t.Errorf("%s: parseBuildInfo = %q, %q; want %q, %q", tt.name, version, commit, tt.wantVersion, tt.wantCommit)
+		}
+	}
+}
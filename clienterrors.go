@@ -0,0 +1,80 @@
+package stackrus
+
+import (
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+var (
+	clientRoutesMu sync.Mutex
+	clientRoutes   = make(map[*logging.Client]*errorRoutes)
+)
+
+// errorRoutes dispatches the errors of a client to the hooks and mirrors
+// writing through it. Clients don't say which logger an error came from, so
+// every route sees every error.
+type errorRoutes struct {
+	prev   func(error)
+	routes []*errorRoute
+}
+
+type errorRoute struct {
+	handle func(error) bool
+}
+
+// routeClientErrors adds handle to the routes of client's errors, installing
+// the dispatcher as the client's OnError function the first time the client
+// is seen. handle reports whether it handled the error; errors that no route
+// handled go to the client's previous OnError function, or to stderr while the
+// standard logger writes through a hook. The previous function is returned
+// along with a function removing the route.
+func routeClientErrors(client *logging.Client, handle func(error) bool) (prev func(error), remove func()) {
+	clientRoutesMu.Lock()
+	defer clientRoutesMu.Unlock()
+	r, ok := clientRoutes[client]
+	if !ok {
+		r = &errorRoutes{prev: client.OnError}
+		clientRoutes[client] = r
+		client.OnError = r.dispatch
+	}
+	route := &errorRoute{handle}
+	r.routes = append(r.routes[:len(r.routes):len(r.routes)], route)
+
+	var once sync.Once
+	return r.prev, func() {
+		once.Do(func() {
+			clientRoutesMu.Lock()
+			defer clientRoutesMu.Unlock()
+			for i, rt := range r.routes {
+				if rt == route {
+					r.routes = append(r.routes[:i:i], r.routes[i+1:]...)
+					break
+				}
+			}
+			if len(r.routes) == 0 && clientRoutes[client] == r {
+				delete(clientRoutes, client)
+			}
+		})
+	}
+}
+
+func (r *errorRoutes) dispatch(err error) {
+	clientRoutesMu.Lock()
+	routes := r.routes
+	clientRoutesMu.Unlock()
+
+	handled := false
+	for _, route := range routes {
+		if route.handle(err) {
+			handled = true
+		}
+	}
+	switch {
+	case handled:
+	case logsToHook():
+		logError(err)
+	case r.prev != nil:
+		r.prev(err)
+	}
+}
@@ -0,0 +1,44 @@
+package stackrus
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestRouteClientErrors(t *testing.T) {
+	client := &logging.Client{}
+	var prevErrs, errs1, errs2 int
+	client.OnError = func(error) { prevErrs++ }
+
+	prev, remove1 := routeClientErrors(client, func(error) bool { errs1++; return false })
+	if prev == nil {
+		t.Fatal("previous OnError function not returned")
+	}
+	_, remove2 := routeClientErrors(client, func(error) bool { errs2++; return true })
+
+	client.OnError(errors.New("handled"))
+	if errs1 != 1 || errs2 != 1 || prevErrs != 0 {
+		t.Errorf("after handled error: routes got %d and %d, previous got %d; want 1, 1 and 0", errs1, errs2, prevErrs)
+	}
+
+	remove2()
+	client.OnError(errors.New("unhandled"))
+	if errs1 != 2 || errs2 != 1 || prevErrs != 1 {
+		t.Errorf("after unhandled error: routes got %d and %d, previous got %d; want 2, 1 and 1", errs1, errs2, prevErrs)
+	}
+
+	remove1()
+	remove1()
+	clientRoutesMu.Lock()
+	_, ok := clientRoutes[client]
+	clientRoutesMu.Unlock()
+	if ok {
+		t.Error("client still registered after removing all routes")
+	}
+	client.OnError(errors.New("no routes"))
+	if prevErrs != 2 {
+		t.Errorf("previous OnError got %d errors, want 2", prevErrs)
+	}
+}
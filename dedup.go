@@ -0,0 +1,149 @@
+package stackrus
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// repeatedLabel is the label key of the summary entries written by
+// deduplication.
+const repeatedLabel = "repeated"
+
+// SetDeduplication collapses identical consecutive entries, i.e. entries
+// with the same log ID, level, message and labels, logged within window of
+// the first one. Duplicates are counted instead of sent, and once the window
+// expires or a different entry is logged, a copy of the first entry labeled
+// repeated=N is sent for the N duplicates, timestamped with the hook's clock.
+// Only the last distinct entry is tracked, so memory use doesn't grow with
+// the number of unique messages. Fatal and Panic entries that are flushed
+// before logrus exits are never collapsed. A window <= 0, the default,
+// disables deduplication.
+func (h *Hook) SetDeduplication(window time.Duration) {
+	h.mu.Lock()
+	h.dedupWindow = window
+	h.mu.Unlock()
+	if window <= 0 {
+		h.flushDedup()
+	}
+}
+
+// dedupState tracks the last distinct entry sent while deduplicating.
+type dedupState struct {
+	key         uint64
+	entry       logging.Entry
+	logID       string
+	logger      EntryLogger
+	sync        bool
+	syncs       syncSettings
+	repeatedKey string
+	clock       func() time.Time
+	count       int
+	timer       *time.Timer
+}
+
+// deduplicate reports whether entry duplicates the last distinct entry and
+// was counted instead of being sent. Otherwise entry becomes the new last
+// distinct entry, and the summary of the previous one is sent.
+func (h *Hook) deduplicate(e *logrus.Entry, s *dedupState, window time.Duration) bool {
+	s.key = dedupKey(e, s.logID, s.entry.Labels)
+
+	h.dedupMu.Lock()
+	last := h.dedupLast
+	if last != nil && last.key == s.key {
+		last.count++
+		h.dedupMu.Unlock()
+		return true
+	}
+	if last != nil {
+		last.timer.Stop()
+	}
+	h.dedupLast = s
+	s.timer = time.AfterFunc(window, func() { h.expireDedup(s) })
+	h.dedupMu.Unlock()
+
+	if last != nil {
+		h.sendSummary(last)
+	}
+	return false
+}
+
+// expireDedup ends the window of s, sending its summary.
+func (h *Hook) expireDedup(s *dedupState) {
+	h.dedupMu.Lock()
+	if h.dedupLast != s {
+		h.dedupMu.Unlock()
+		return
+	}
+	h.dedupLast = nil
+	h.dedupMu.Unlock()
+	h.sendSummary(s)
+}
+
+// flushDedup sends the summary of the last distinct entry, if any, e.g.
+// before the hook is closed.
+func (h *Hook) flushDedup() {
+	h.dedupMu.Lock()
+	s := h.dedupLast
+	h.dedupLast = nil
+	h.dedupMu.Unlock()
+	if s != nil {
+		s.timer.Stop()
+		h.sendSummary(s)
+	}
+}
+
+// sendSummary sends a copy of the entry of s labeled with its number of
+// duplicates, if it had any.
+func (h *Hook) sendSummary(s *dedupState) {
+	if s.count == 0 {
+		return
+	}
+	labels := make(map[string]string, len(s.entry.Labels)+1)
+	for k, v := range s.entry.Labels {
+		labels[k] = v
+	}
+	labels[s.repeatedKey] = strconv.Itoa(s.count)
+	entry := s.entry
+	entry.Labels = labels
+	entry.Timestamp = s.clock()
+	entry.InsertID = ""
+
+	if h.writeDryRun(entry, s.logID) {
+		return
+	}
+	if !s.sync {
+		s.logger.Log(entry)
+	} else if err := s.syncs.logSync(s.logger, entry); err != nil {
+		atomic.AddUint64(&h.counters.failed, 1)
+		h.reportError(err)
+		return
+	}
+	atomic.AddUint64(&h.counters.sent, 1)
+}
+
+// dedupKey hashes the log ID, level, message and labels of an entry.
+func dedupKey(e *logrus.Entry, logID string, labels map[string]string) uint64 {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	f := fnv.New64a()
+	f.Write([]byte(logID))
+	f.Write([]byte{0, byte(e.Level)})
+	f.Write([]byte(e.Message))
+	for _, k := range keys {
+		f.Write([]byte{0})
+		f.Write([]byte(k))
+		f.Write([]byte{0})
+		f.Write([]byte(labels[k]))
+	}
+	return f.Sum64()
+}
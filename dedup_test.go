@@ -0,0 +1,36 @@
+package stackrus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDeduplicationPerLogID(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.SetClock(func() time.Time { return now })
+	h.SetDynamicLogIDKey("log")
+	h.SetDeduplication(time.Hour)
+
+	fire(t, h, l, logrus.InfoLevel, "same", logrus.Fields{"log": "a"})
+	fire(t, h, l, logrus.InfoLevel, "same", logrus.Fields{"log": "b"})
+	if len(l.entries) != 2 {
+		t.Fatalf("got %d entries, want an entry for each log ID", len(l.entries))
+	}
+	h.Fire(&logrus.Entry{Data: logrus.Fields{"log": "b"}, Time: time.Now(), Level: logrus.InfoLevel, Message: "same"})
+	if len(l.entries) != 2 {
+		t.Fatalf("got %d entries, want the duplicate to be counted", len(l.entries))
+	}
+
+	h.flushDedup()
+	summary := l.last(t)
+	if got := summary.Labels[repeatedLabel]; got != "1" {
+		t.Errorf("summary label %s = %q, want %q", repeatedLabel, got, "1")
+	}
+	if !summary.Timestamp.Equal(now) {
+		t.Errorf("summary timestamp = %v, want the clock's %v", summary.Timestamp, now)
+	}
+}
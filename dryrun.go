@@ -0,0 +1,109 @@
+package stackrus
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"cloud.google.com/go/logging"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+// SetDryRun makes the hook write each entry it would send to w as a line of
+// JSON, instead of sending it to Stackdriver, e.g. to check labels, payloads
+// and trace fields locally. Entries are fully built, including sampling,
+// filtering and label promotion. A nil w turns dry-run mode off.
+func (h *Hook) SetDryRun(w io.Writer) {
+	h.dryRun.Store(dryRunWriter{w})
+}
+
+// dryRunWriter wraps the dry-run writer so that a nil writer can be stored in
+// an atomic.Value.
+type dryRunWriter struct {
+	w io.Writer
+}
+
+// dryRunEntry is the JSON rendering of a logging.Entry in dry-run mode.
+type dryRunEntry struct {
+	LogID          string                        `json:"logID,omitempty"`
+	Timestamp      time.Time                     `json:"timestamp"`
+	Severity       string                        `json:"severity"`
+	Payload        interface{}                   `json:"payload"`
+	Labels         map[string]string             `json:"labels,omitempty"`
+	InsertID       string                        `json:"insertID,omitempty"`
+	HTTPRequest    *dryRunHTTPRequest            `json:"httpRequest,omitempty"`
+	Operation      *logpb.LogEntryOperation      `json:"operation,omitempty"`
+	Trace          string                        `json:"trace,omitempty"`
+	SpanID         string                        `json:"spanID,omitempty"`
+	TraceSampled   bool                          `json:"traceSampled,omitempty"`
+	SourceLocation *logpb.LogEntrySourceLocation `json:"sourceLocation,omitempty"`
+	Resource       *mrpb.MonitoredResource       `json:"resource,omitempty"`
+}
+
+// dryRunHTTPRequest is the JSON rendering of a logging.HTTPRequest, whose
+// *http.Request can't be marshaled.
+type dryRunHTTPRequest struct {
+	Method       string        `json:"method,omitempty"`
+	URL          string        `json:"url,omitempty"`
+	UserAgent    string        `json:"userAgent,omitempty"`
+	Referer      string        `json:"referer,omitempty"`
+	RequestSize  int64         `json:"requestSize,omitempty"`
+	Status       int           `json:"status,omitempty"`
+	ResponseSize int64         `json:"responseSize,omitempty"`
+	Latency      time.Duration `json:"latency,omitempty"`
+	LocalIP      string        `json:"localIP,omitempty"`
+	RemoteIP     string        `json:"remoteIP,omitempty"`
+	CacheHit     bool          `json:"cacheHit,omitempty"`
+}
+
+// writeDryRun writes entry to the dry-run writer and reports whether
+// dry-run mode is on.
+func (h *Hook) writeDryRun(entry logging.Entry, logID string) bool {
+	dw, _ := h.dryRun.Load().(dryRunWriter)
+	if dw.w == nil {
+		return false
+	}
+	d := dryRunEntry{
+		LogID:          logID,
+		Timestamp:      entry.Timestamp,
+		Severity:       entry.Severity.String(),
+		Payload:        entry.Payload,
+		Labels:         entry.Labels,
+		InsertID:       entry.InsertID,
+		Operation:      entry.Operation,
+		Trace:          entry.Trace,
+		SpanID:         entry.SpanID,
+		TraceSampled:   entry.TraceSampled,
+		SourceLocation: entry.SourceLocation,
+		Resource:       entry.Resource,
+	}
+	if r := entry.HTTPRequest; r != nil {
+		d.HTTPRequest = &dryRunHTTPRequest{
+			RequestSize:  r.RequestSize,
+			Status:       r.Status,
+			ResponseSize: r.ResponseSize,
+			Latency:      r.Latency,
+			LocalIP:      r.LocalIP,
+			RemoteIP:     r.RemoteIP,
+			CacheHit:     r.CacheHit,
+		}
+		if req := r.Request; req != nil {
+			d.HTTPRequest.Method = req.Method
+			d.HTTPRequest.UserAgent = req.UserAgent()
+			d.HTTPRequest.Referer = req.Referer()
+			if req.URL != nil {
+				d.HTTPRequest.URL = req.URL.String()
+			}
+		}
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		h.reportError(err)
+		return true
+	}
+	h.dryRunMu.Lock()
+	defer h.dryRunMu.Unlock()
+	dw.w.Write(append(b, '\n'))
+	return true
+}
@@ -0,0 +1,40 @@
+package stackrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDryRun(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var buf bytes.Buffer
+	h.SetDryRun(&buf)
+
+	e := &logrus.Entry{Data: logrus.Fields{"n": 1}, Time: time.Now(), Level: logrus.WarnLevel, Message: "dry"}
+	if err := h.Fire(e); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	var d dryRunEntry
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatalf("dry-run output %q: %v", buf.String(), err)
+	}
+	if d.Severity != "Warning" {
+		t.Errorf("Severity = %q, want Warning", d.Severity)
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("dry-run entry was sent: %v", l.entries)
+	}
+
+	h.SetDryRun(nil)
+	if err := h.Fire(e); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	if len(l.entries) != 1 {
+		t.Errorf("got %d entries after disabling dry-run mode, want 1", len(l.entries))
+	}
+}
@@ -0,0 +1,122 @@
+package stackrus
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stackTraceKey is the payload key under which error stack traces are stored.
+const stackTraceKey = "stack_trace"
+
+// reportedErrorEventType marks a jsonPayload as an Error Reporting event.
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// errorContextKey is the payload key of the Error Reporting context, and
+// contextFieldKey the key a colliding "context" field is moved to.
+const (
+	errorContextKey = "context"
+	contextFieldKey = "context_field"
+)
+
+// SetErrorReporting enables formatting entries at logrus.ErrorLevel and above
+// so that they are picked up by Stackdriver Error Reporting. Entries without
+// an error stack trace get the stack of the logging goroutine. A "context"
+// field of an entry with a caller is moved to "context_field", unless
+// "context" is the payload namespace, to make room for the report location.
+func (h *Hook) SetErrorReporting(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errorReporting = enabled
+}
+
+// SetServiceContext sets the service name and version reported to Error
+// Reporting.
+func (h *Hook) SetServiceContext(service, version string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.serviceName = service
+	h.serviceVersion = version
+}
+
+// addErrorReport adds the fields Error Reporting needs to the payload of
+// entries at logrus.ErrorLevel and above.
+func (b *entryBuilder) addErrorReport(e *logrus.Entry, payload map[string]interface{}) {
+	if !b.errorReporting || e.Level > logrus.ErrorLevel {
+		return
+	}
+	payload["@type"] = reportedErrorEventType
+	if b.serviceName != "" {
+		serviceContext := map[string]string{"service": b.serviceName}
+		if b.serviceVersion != "" {
+			serviceContext["version"] = b.serviceVersion
+		}
+		payload["serviceContext"] = serviceContext
+	}
+	if _, ok := payload[stackTraceKey]; !ok {
+		payload[stackTraceKey] = string(debug.Stack())
+	}
+	if e.Caller != nil {
+		var errContext map[string]interface{}
+		if b.payloadNamespace == errorContextKey {
+			// The context already holds the entry's fields, in a map built
+			// by buildPayload.
+			errContext, _ = payload[errorContextKey].(map[string]interface{})
+		} else if v, ok := payload[errorContextKey]; ok {
+			b.moveContextField(payload, v)
+		}
+		if errContext == nil {
+			errContext = make(map[string]interface{}, 1)
+			payload[errorContextKey] = errContext
+		}
+		errContext["reportLocation"] = map[string]interface{}{
+			"filePath":     e.Caller.File,
+			"lineNumber":   e.Caller.Line,
+			"functionName": e.Caller.Function,
+		}
+	}
+}
+
+// moveContextField moves a "context" field out of the way of the error
+// context, to contextFieldKey, or drops it if that key is taken too.
+func (b *entryBuilder) moveContextField(payload map[string]interface{}, v interface{}) {
+	if _, taken := payload[contextFieldKey]; taken {
+		b.h.contextKeyOnce.Do(func() {
+			b.report(fmt.Errorf("field %q collides with the error context and was dropped", errorContextKey))
+		})
+	} else {
+		payload[contextFieldKey] = v
+	}
+	delete(payload, errorContextKey)
+}
+
+// SetErrorFieldKey sets the name of the field holding the entry's error, as
+// set by logrus.WithError. Defaults to logrus.ErrorKey; codebases that log
+// errors under another key, e.g. "err", should set it so that the error's
+// stack trace is extracted and used by Error Reporting instead of the stack
+// of the logging goroutine.
+func (h *Hook) SetErrorFieldKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errorKey = key
+}
+
+// errorStackTrace returns the formatted stack trace of err if it carries one,
+// either through a StackTrace method (as with github.com/pkg/errors) or a
+// fmt.Formatter whose %+v verb includes the stack.
+func errorStackTrace(v interface{}) (string, bool) {
+	err, ok := v.(error)
+	if !ok || err == nil || isNilPointer(err) {
+		return "", false
+	}
+	if m := reflect.ValueOf(err).MethodByName("StackTrace"); m.IsValid() &&
+		m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return fmt.Sprintf("%+v", m.Call(nil)[0].Interface()), true
+	}
+	if f, ok := err.(fmt.Formatter); ok {
+		return fmt.Sprintf("%+v", f), true
+	}
+	return "", false
+}
@@ -0,0 +1,105 @@
+package stackrus
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fireWithCaller sends an Error entry with fields and a caller through h,
+// returning the logged payload.
+func fireWithCaller(t *testing.T, h *Hook, l *fakeLogger, fields logrus.Fields) map[string]interface{} {
+	t.Helper()
+	e := &logrus.Entry{
+		Data:    fields,
+		Time:    time.Now(),
+		Level:   logrus.ErrorLevel,
+		Message: "failed",
+		Caller:  &runtime.Frame{File: "main.go", Line: 42, Function: "main.main"},
+	}
+	if err := h.Fire(e); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	return l.last(t).Payload.(map[string]interface{})
+}
+
+// stackError is an error carrying a stack trace, like those of
+// github.com/pkg/errors.
+type stackError struct{}
+
+func (stackError) Error() string { return "boom" }
+
+func (stackError) StackTrace() []string { return []string{"main.main", "main.go:42"} }
+
+func TestCustomErrorKeyStackTrace(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetErrorFieldKey("err")
+	h.SetErrorReporting(true)
+
+	payload := fire(t, h, l, logrus.ErrorLevel, "failed", logrus.Fields{"err": stackError{}})
+	if got := payload["err"]; got != "boom" {
+		t.Errorf("payload[err] = %v, want %q", got, "boom")
+	}
+	if got, want := payload[stackTraceKey], "[main.main main.go:42]"; got != want {
+		t.Errorf("payload[%s] = %v, want the error's stack %q", stackTraceKey, got, want)
+	}
+	if got := payload["@type"]; got != reportedErrorEventType {
+		t.Errorf("payload[@type] = %v, want %q", got, reportedErrorEventType)
+	}
+
+	payload = fire(t, h, l, logrus.WarnLevel, "not reported", logrus.Fields{"err": stackError{}})
+	if _, ok := payload["@type"]; ok {
+		t.Error("Warn entry formatted for Error Reporting")
+	}
+}
+
+func TestErrorStackTraceNilPointer(t *testing.T) {
+	var err error = (*stackError)(nil)
+	if _, ok := errorStackTrace(err); ok {
+		t.Error("errorStackTrace(nil *stackError) returned a stack trace")
+	}
+}
+
+func TestErrorReportContextField(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetErrorReporting(true)
+	userContext := map[string]interface{}{"tenant": "acme"}
+
+	payload := fireWithCaller(t, h, l, logrus.Fields{"context": userContext})
+	if got := payload[contextFieldKey]; !reflect.DeepEqual(got, userContext) {
+		t.Errorf("payload[%q] = %v, want %v", contextFieldKey, got, userContext)
+	}
+	errContext, ok := payload[errorContextKey].(map[string]interface{})
+	if !ok || errContext["reportLocation"] == nil {
+		t.Errorf("payload[%q] = %v, want a report location", errorContextKey, payload[errorContextKey])
+	}
+	if len(userContext) != 1 {
+		t.Errorf("user's context field was modified: %v", userContext)
+	}
+
+	payload = fireWithCaller(t, h, l, logrus.Fields{"context": userContext, contextFieldKey: "taken"})
+	if got := payload[contextFieldKey]; got != "taken" {
+		t.Errorf("payload[%q] = %v, want the original field", contextFieldKey, got)
+	}
+}
+
+func TestErrorReportContextNamespace(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetErrorReporting(true)
+	h.SetPayloadNamespace(errorContextKey)
+
+	payload := fireWithCaller(t, h, l, logrus.Fields{"tenant": "acme"})
+	errContext, ok := payload[errorContextKey].(map[string]interface{})
+	if !ok {
+		t.Fatalf("payload[%q] = %v, want a map", errorContextKey, payload[errorContextKey])
+	}
+	if errContext["tenant"] != "acme" || errContext["reportLocation"] == nil {
+		t.Errorf("payload[%q] = %v, want the fields and the report location", errorContextKey, errContext)
+	}
+}
@@ -0,0 +1,44 @@
+package stackrus
+
+import (
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var fallbackFormatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+
+// SetFallbackWriter sets a writer, e.g. os.Stderr, that receives a
+// text-formatted copy of entries that couldn't be delivered synchronously.
+// Errors reported by the client in async mode don't identify the failed
+// entries, so those are written to the fallback as error lines instead.
+func (h *Hook) SetFallbackWriter(w io.Writer) {
+	h.fallbackMu.Lock()
+	defer h.fallbackMu.Unlock()
+	h.fallback = w
+}
+
+// writeFallback writes e to the fallback writer, if any.
+func (h *Hook) writeFallback(e *logrus.Entry) {
+	h.fallbackMu.Lock()
+	defer h.fallbackMu.Unlock()
+	if h.fallback == nil {
+		return
+	}
+	b, err := fallbackFormatter.Format(e)
+	if err != nil {
+		return
+	}
+	h.fallback.Write(b)
+}
+
+// writeFallbackError writes a client error to the fallback writer, if any.
+func (h *Hook) writeFallbackError(err error) {
+	h.writeFallback(&logrus.Entry{
+		Data:    logrus.Fields{logrus.ErrorKey: err.Error()},
+		Time:    time.Now(),
+		Level:   logrus.ErrorLevel,
+		Message: "stackrus: failed to deliver entries",
+	})
+}
@@ -0,0 +1,76 @@
+package stackrus
+
+import (
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values of Hook.disabled.
+const (
+	hookEnabled int32 = iota
+	hookDisabled
+	hookDisabledCounted
+)
+
+// SetEnabled turns the hook on or off at runtime, e.g. to mute it during a
+// noisy migration without removing it from logrus. While disabled, Fire
+// returns immediately. It is a single atomic store, safe to call under load.
+func (h *Hook) SetEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&h.disabled, hookEnabled)
+	} else {
+		atomic.StoreInt32(&h.disabled, hookDisabled)
+	}
+}
+
+// Disable is like SetEnabled(false), but entries fired while disabled are
+// counted in HookStats.Dropped if count is set.
+func (h *Hook) Disable(count bool) {
+	if count {
+		atomic.StoreInt32(&h.disabled, hookDisabledCounted)
+	} else {
+		atomic.StoreInt32(&h.disabled, hookDisabled)
+	}
+}
+
+// muted reports whether the hook is closed or disabled, counting the n
+// entries given to it as dropped if needed.
+func (h *Hook) muted(n uint64) bool {
+	if atomic.LoadInt32(&h.closed) != 0 {
+		atomic.AddUint64(&h.counters.dropped, n)
+		return true
+	}
+	switch atomic.LoadInt32(&h.disabled) {
+	case hookDisabled:
+		return true
+	case hookDisabledCounted:
+		atomic.AddUint64(&h.counters.dropped, n)
+		return true
+	}
+	return false
+}
+
+// SetFilter sets a predicate that entries must satisfy to be sent, e.g. to
+// ship only entries with audit=true through this hook. It runs before any
+// other processing of the entry. Filtered entries aren't counted in
+// HookStats.
+func (h *Hook) SetFilter(filter func(*logrus.Entry) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.filter = filter
+}
+
+// SetRespectContextCancellation makes Fire drop entries whose context, set
+// with logrus.WithContext, is already done, e.g. because the client of a
+// request disconnected. Dropped entries are counted in HookStats.Dropped.
+func (h *Hook) SetRespectContextCancellation(respect bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.respectCancellation = respect
+}
+
+// canceled reports whether e should be dropped because its context is done.
+func (b *entryBuilder) canceled(e *logrus.Entry) bool {
+	return b.respectCancellation && e.Context != nil && e.Context.Err() != nil
+}
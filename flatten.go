@@ -0,0 +1,38 @@
+package stackrus
+
+import "reflect"
+
+// maxFlattenDepth caps how deeply nested maps are flattened. Maps nested
+// deeper than this, including cyclic ones, are stored as-is.
+const maxFlattenDepth = 10
+
+// SetFlattenNestedFields enables flattening map-valued payload fields into
+// top-level keys joined by the flatten separator, so that
+// {"user": {"id": 5}} becomes {"user.id": 5}.
+func (h *Hook) SetFlattenNestedFields(flatten bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flatten = flatten
+}
+
+// SetFlattenSeparator sets the separator used to join flattened keys.
+// Defaults to ".".
+func (h *Hook) SetFlattenSeparator(sep string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flattenSep = sep
+}
+
+// flattenInto stores v in payload under key, recursively expanding maps with
+// string keys into separate entries.
+func (b *entryBuilder) flattenInto(payload map[string]interface{}, key string, v interface{}, depth int) {
+	rv := reflect.ValueOf(v)
+	if depth >= maxFlattenDepth || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String || rv.Len() == 0 {
+		payload[key] = b.payloadValue(v)
+		return
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		b.flattenInto(payload, key+b.flattenSep+iter.Key().String(), iter.Value().Interface(), depth+1)
+	}
+}
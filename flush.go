@@ -0,0 +1,205 @@
+package stackrus
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultFatalFlushTimeout bounds how long Fire waits to deliver Fatal and
+// Panic entries, so a hung network can't keep the process from exiting.
+const DefaultFatalFlushTimeout = 5 * time.Second
+
+// SetFlushOnFatal controls whether Fatal entries are delivered before Fire
+// returns even in async mode, since logrus exits right after firing hooks
+// for them. Buffered entries are flushed first. Enabled by default.
+func (h *Hook) SetFlushOnFatal(flush bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushOnFatal = flush
+}
+
+// SetFlushOnPanic is like SetFlushOnFatal for Panic entries, after which
+// logrus panics and the goroutine unwinds. Enabled by default.
+func (h *Hook) SetFlushOnPanic(flush bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushOnPanic = flush
+}
+
+// SetFatalFlushTimeout sets how long Fire may block delivering Fatal and
+// Panic entries. Defaults to DefaultFatalFlushTimeout.
+func (h *Hook) SetFatalFlushTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fatalFlushTimeout = timeout
+}
+
+// RegisterAsExitHandler registers a flush of the hook, bounded by the fatal
+// flush timeout, with logrus.RegisterExitHandler, so that buffered entries
+// are delivered when logrus exits the process after a Fatal entry. Exit
+// handlers run after the hooks have fired, so this complements rather than
+// replaces SetFlushOnFatal, which delivers the Fatal entry itself before
+// Fire returns. logrus has no way to unregister handlers, so call it once.
+func (h *Hook) RegisterAsExitHandler() {
+	logrus.RegisterExitHandler(func() {
+		h.mu.RLock()
+		timeout := h.fatalFlushTimeout
+		h.mu.RUnlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := h.flushContext(ctx); err != nil {
+			h.reportError(err)
+		}
+	})
+}
+
+// sendsFinal reports whether e is the last entry before logrus exits or
+// panics and has to be delivered synchronously, after flushing the entries
+// buffered before it.
+func (b *entryBuilder) sendsFinal(e *logrus.Entry) bool {
+	if !b.buffersEntries() {
+		return false
+	}
+	switch e.Level {
+	case logrus.FatalLevel:
+		return b.flushOnFatal
+	case logrus.PanicLevel:
+		return b.flushOnPanic
+	}
+	return false
+}
+
+// buffersEntries reports whether any entries are written asynchronously,
+// either to mirrors or at a level that isn't written synchronously.
+func (b *entryBuilder) buffersEntries() bool {
+	if len(b.mirrors) > 0 {
+		return true
+	}
+	if b.sync {
+		return false
+	}
+	levels := b.levels
+	if levels == nil {
+		levels = logrus.AllLevels
+	}
+	for _, l := range levels {
+		if !b.syncLevels[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// logFinal flushes buffered entries and then synchronously writes entry, all
+// within timeout.
+func (h *Hook) logFinal(logger EntryLogger, entry logging.Entry, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := h.flushContext(ctx); err != nil {
+		h.reportError(err)
+	}
+	return logger.LogSync(ctx, entry)
+}
+
+// FlushTimeout is like Flush, but gives up when ctx is done and returns
+// ctx.Err(), e.g. context.DeadlineExceeded, so that shutdown can't hang past
+// a grace period. The flush keeps running in the background if ctx expires
+// first. It is safe to call concurrently with Fire.
+func (h *Hook) FlushTimeout(ctx context.Context) error {
+	return h.flushContext(ctx)
+}
+
+// flushContext flushes the hook, giving up when ctx is done.
+func (h *Hook) flushContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Flush()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetFlushEveryN makes the hook flush in the background after every n
+// entries handed to the logger asynchronously, by Fire or FireBatch, to
+// relieve the buffer on bursty workloads. A flush isn't started while the
+// previous one is still running. A value <= 0, the default, disables it.
+func (h *Hook) SetFlushEveryN(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushEveryN = n
+}
+
+// countEnqueued counts an async entry and starts a flush every n entries.
+func (h *Hook) countEnqueued(n int) {
+	if n <= 0 || atomic.AddUint64(&h.counters.enqueued, 1)%uint64(n) != 0 {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&h.flushing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&h.flushing, 0)
+		if err := h.Flush(); err != nil {
+			h.reportError(err)
+		}
+	}()
+}
+
+// StartPeriodicFlush starts a goroutine that flushes the hook every interval,
+// so that entries on low-traffic services aren't held in the buffer for
+// long. Flush errors go to the error handler. Calling it again replaces the
+// running flusher, and an interval <= 0 stops it like StopPeriodicFlush.
+func (h *Hook) StartPeriodicFlush(interval time.Duration) {
+	h.flusherMu.Lock()
+	defer h.flusherMu.Unlock()
+	h.stopFlusher()
+	if interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	h.flusherStop, h.flusherDone = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := h.Flush(); err != nil {
+					h.reportError(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopPeriodicFlush stops the flusher started by StartPeriodicFlush and waits
+// for it to exit. It is safe to call if no flusher is running.
+func (h *Hook) StopPeriodicFlush() {
+	h.flusherMu.Lock()
+	defer h.flusherMu.Unlock()
+	h.stopFlusher()
+}
+
+// stopFlusher must be called with h.flusherMu held.
+func (h *Hook) stopFlusher() {
+	if h.flusherStop == nil {
+		return
+	}
+	close(h.flusherStop)
+	<-h.flusherDone
+	h.flusherStop, h.flusherDone = nil, nil
+}
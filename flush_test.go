@@ -0,0 +1,59 @@
+package stackrus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPanicEntryIsSentSynchronously(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+
+	fire(t, h, l, logrus.ErrorLevel, "async", nil)
+	if l.syncs != 0 {
+		t.Fatal("Error entry sent with LogSync")
+	}
+	fire(t, h, l, logrus.PanicLevel, "panic", nil)
+	if l.syncs != 1 {
+		t.Error("Panic entry not sent with LogSync")
+	}
+
+	h.SetFlushOnPanic(false)
+	fire(t, h, l, logrus.PanicLevel, "panic", nil)
+	if l.syncs != 1 {
+		t.Error("Panic entry sent with LogSync with SetFlushOnPanic(false)")
+	}
+}
+
+func TestFatalEntryFlushesBufferedEntries(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetSyncLevels(logrus.FatalLevel)
+	fire(t, h, l, logrus.InfoLevel, "buffered", nil)
+	fire(t, h, l, logrus.FatalLevel, "fatal", nil)
+	if l.flushes != 1 {
+		t.Errorf("got %d flushes before a sync Fatal entry, want 1", l.flushes)
+	}
+
+	l = &fakeLogger{}
+	h = NewWithLogger(l, WithSync())
+	fire(t, h, l, logrus.FatalLevel, "fatal", nil)
+	if l.flushes != 0 {
+		t.Errorf("got %d flushes before a Fatal entry on a sync hook, want 0", l.flushes)
+	}
+}
+
+func TestStartPeriodicFlushNonPositiveIntervalStops(t *testing.T) {
+	h := NewWithLogger(&fakeLogger{})
+	h.StartPeriodicFlush(time.Hour)
+	h.StartPeriodicFlush(0)
+	if h.flusherStop != nil {
+		t.Error("flusher still running after StartPeriodicFlush(0)")
+	}
+	h.StartPeriodicFlush(-time.Second)
+	if h.flusherStop != nil {
+		t.Error("flusher started by StartPeriodicFlush with a negative interval")
+	}
+}
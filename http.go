@@ -0,0 +1,155 @@
+package stackrus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// HTTPRequestFields names the logrus fields that are used to build an entry's
+// logging.HTTPRequest. Fields with an empty name are not looked up.
+type HTTPRequestFields struct {
+	Method       string
+	URL          string
+	Status       string
+	Latency      string
+	RequestSize  string
+	ResponseSize string
+	RemoteIP     string
+	UserAgent    string
+	Referer      string
+}
+
+// DefaultHTTPRequestFields are the field names typically used by access log
+// middleware.
+var DefaultHTTPRequestFields = HTTPRequestFields{
+	Method:       "method",
+	URL:          "url",
+	Status:       "status",
+	Latency:      "latency",
+	RequestSize:  "requestSize",
+	ResponseSize: "responseSize",
+	RemoteIP:     "remoteIP",
+	UserAgent:    "userAgent",
+	Referer:      "referer",
+}
+
+// SetHTTPRequestFields enables building a logging.HTTPRequest for entries
+// that carry a parseable URL field. Consumed fields are removed from the
+// payload; fields whose values can't be parsed are left in the payload.
+func (h *Hook) SetHTTPRequestFields(fields HTTPRequestFields) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.httpFields = &fields
+}
+
+// extractHTTPRequest builds an HTTPRequest from data, removing the fields it
+// consumes. It returns nil if HTTP request fields are not configured or the
+// entry has no parseable URL.
+func (b *entryBuilder) extractHTTPRequest(data map[string]interface{}) *logging.HTTPRequest {
+	if b.httpFields == nil {
+		return nil
+	}
+	f := b.httpFields
+	u, ok := parseURL(data[f.URL])
+	if !ok {
+		return nil
+	}
+	delete(data, f.URL)
+
+	req := &http.Request{URL: u, Header: make(http.Header)}
+	r := &logging.HTTPRequest{Request: req}
+	if v, ok := data[f.Method].(string); ok && f.Method != "" {
+		req.Method = v
+		delete(data, f.Method)
+	}
+	if v, ok := data[f.UserAgent].(string); ok && f.UserAgent != "" {
+		req.Header.Set("User-Agent", v)
+		delete(data, f.UserAgent)
+	}
+	if v, ok := data[f.Referer].(string); ok && f.Referer != "" {
+		req.Header.Set("Referer", v)
+		delete(data, f.Referer)
+	}
+	if v, ok := data[f.RemoteIP].(string); ok && f.RemoteIP != "" {
+		r.RemoteIP = v
+		delete(data, f.RemoteIP)
+	}
+	if v, ok := parseInt(data[f.Status]); ok && f.Status != "" {
+		r.Status = int(v)
+		delete(data, f.Status)
+	}
+	if v, ok := parseInt(data[f.RequestSize]); ok && f.RequestSize != "" {
+		r.RequestSize = v
+		delete(data, f.RequestSize)
+	}
+	if v, ok := parseInt(data[f.ResponseSize]); ok && f.ResponseSize != "" {
+		r.ResponseSize = v
+		delete(data, f.ResponseSize)
+	}
+	if v, ok := parseDuration(data[f.Latency]); ok && f.Latency != "" {
+		r.Latency = v
+		delete(data, f.Latency)
+	}
+	return r
+}
+
+func parseURL(v interface{}) (*url.URL, bool) {
+	switch t := v.(type) {
+	case *url.URL:
+		return t, t != nil
+	case url.URL:
+		return &t, true
+	case string:
+		u, err := url.Parse(t)
+		return u, err == nil
+	default:
+		return nil, false
+	}
+}
+
+func parseInt(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case int:
+		return int64(t), true
+	case int32:
+		return int64(t), true
+	case int64:
+		return t, true
+	case uint:
+		return int64(t), true
+	case uint32:
+		return int64(t), true
+	case uint64:
+		return int64(t), true
+	case float64:
+		return int64(t), float64(int64(t)) == t
+	case string:
+		i, err := strconv.ParseInt(t, 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseDuration(v interface{}) (time.Duration, bool) {
+	switch t := v.(type) {
+	case time.Duration:
+		return t, true
+	case string:
+		d, err := time.ParseDuration(t)
+		return d, err == nil
+	case fmt.Stringer:
+		if isNilPointer(t) {
+			return 0, false
+		}
+		d, err := time.ParseDuration(t.String())
+		return d, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,414 @@
+package stackrus
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxLabelValueLength is the maximum length in bytes of a label value
+// accepted by the Stackdriver API.
+const DefaultMaxLabelValueLength = 64 * 1024
+
+// DefaultMaxLabelsPerEntry is the default maximum number of labels on an
+// entry, the limit of the Stackdriver API.
+const DefaultMaxLabelsPerEntry = 64
+
+// labelsTruncatedLabel marks entries whose excess labels were dropped. Like
+// the other labels written by the hook, it gets the label prefix.
+const labelsTruncatedLabel = "labels_truncated"
+
+// truncatedMarker is appended to label values that were truncated.
+const truncatedMarker = "..."
+
+// SetMaxLabelValueLength sets the maximum length in bytes of label values.
+// Longer values are truncated and end with "...". A value <= 0 disables
+// truncation.
+func (h *Hook) SetMaxLabelValueLength(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxLabelValueLength = n
+}
+
+// SetAllFieldsAsLabels makes every entry field a label, leaving only the
+// message in the payload. While enabled, the keys given to SetLabels are
+// ignored.
+func (h *Hook) SetAllFieldsAsLabels(all bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.allFieldsAsLabels = all
+}
+
+// SetDuplicatedLabelKeys sets field keys that are copied to labels while also
+// being kept in the payload, unlike the keys given to SetLabels, which are
+// moved. Labels are indexed by Stackdriver, so only use this for fields with
+// a small set of distinct values: high-cardinality labels such as user or
+// request IDs degrade query performance and can exceed label quotas.
+func (h *Hook) SetDuplicatedLabelKeys(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.duplicatedLabels = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		h.duplicatedLabels[k] = true
+	}
+}
+
+// Labeler is implemented by field values that know which of their attributes
+// should be labels. The labels returned by a Labeler field value are merged
+// into the entry's labels, and the value itself is omitted from the payload
+// unless SetKeepLabelerFields is enabled.
+type Labeler interface {
+	StackdriverLabels() map[string]string
+}
+
+// SetKeepLabelerFields makes field values implementing Labeler be kept in
+// the payload in addition to contributing their labels.
+func (h *Hook) SetKeepLabelerFields(keep bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.keepLabelerFields = keep
+}
+
+// addLabelerLabels merges the labels of l into labels.
+func (b *entryBuilder) addLabelerLabels(labels map[string]string, l Labeler) {
+	for k, v := range l.StackdriverLabels() {
+		labels[b.labelKey(k)] = truncate(v, b.maxLabelValueLength)
+	}
+}
+
+// isLabel reports whether the field k is promoted to a label.
+func (b *entryBuilder) isLabel(k string) bool {
+	return b.allFieldsAsLabels || b.labels[k]
+}
+
+// SetSeverityLabels sets extra labels for entries at given levels, e.g.
+// priority=high for logrus.ErrorLevel and logrus.FatalLevel. They are applied
+// last, so they override default labels, context labels and labels promoted
+// from entry fields with the same key.
+func (h *Hook) SetSeverityLabels(labels map[logrus.Level]map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.severityLabels = make(map[logrus.Level]map[string]string, len(labels))
+	for level, ls := range labels {
+		m := make(map[string]string, len(ls))
+		for k, v := range ls {
+			m[k] = v
+		}
+		h.severityLabels[level] = m
+	}
+}
+
+// componentLabel is the reserved label key set by SetComponentName.
+const componentLabel = "component"
+
+// SetComponentName adds a component label with the given name to every
+// entry, to tell apart the subsystems writing to one log. Labels promoted
+// from entry fields don't override it. An empty name removes the label.
+func (h *Hook) SetComponentName(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.componentName = name
+}
+
+// SetLabelPrefix sets a prefix that is prepended to the key of every label
+// written by the hook, including default labels, e.g. "checkout/". The prefix
+// is used as is: SetSanitizeLabelKeys only applies to the rest of the key.
+func (h *Hook) SetLabelPrefix(prefix string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.labelPrefix = prefix
+}
+
+func (b *entryBuilder) labelKey(k string) string {
+	return b.labelPrefix + k
+}
+
+// DurationFormat selects how time.Duration values are written as labels.
+type DurationFormat int
+
+const (
+	// DurationFormatString writes durations as Go formats them, e.g. "1.5s".
+	DurationFormatString DurationFormat = iota
+	// DurationFormatMillis writes durations as a number of milliseconds,
+	// e.g. "1500" or "0.25".
+	DurationFormatMillis
+)
+
+// SetDurationLabelFormat sets how time.Duration field values promoted to
+// labels are written. Defaults to DurationFormatString. Durations in the
+// payload are controlled by SetNormalizeTimeFields.
+func (h *Hook) SetDurationLabelFormat(format DurationFormat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.durationLabelFormat = format
+}
+
+// labelValue converts a field value to a label value. Marshalers are
+// preferred over fmt.Stringer, which types such as UUIDs and enums may not
+// implement, and %v.
+func (b *entryBuilder) labelValue(v interface{}) string {
+	if m, ok := v.(encoding.TextMarshaler); ok && !isNilPointer(m) {
+		if text, err := m.MarshalText(); err == nil {
+			return truncate(string(text), b.maxLabelValueLength)
+		}
+	}
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = t
+	case int:
+		s = strconv.Itoa(t)
+	case int64:
+		s = strconv.FormatInt(t, 10)
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(t)
+	case time.Duration:
+		if b.durationLabelFormat == DurationFormatMillis {
+			s = strconv.FormatFloat(float64(t)/float64(time.Millisecond), 'f', -1, 64)
+		} else {
+			s = t.String()
+		}
+	case fmt.Stringer:
+		if isNilPointer(t) {
+			s = "<nil>"
+		} else {
+			s = t.String()
+		}
+	case json.Marshaler:
+		if isNilPointer(t) {
+			s = "<nil>"
+		} else {
+			s = jsonLabelValue(t)
+		}
+	default:
+		s = fmt.Sprintf("%v", t)
+	}
+	return truncate(s, b.maxLabelValueLength)
+}
+
+// isNilPointer reports whether v is a nil pointer, on which methods such as
+// String or MarshalText may panic.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// jsonLabelValue returns the JSON encoding of m, unquoted if it is a string.
+func jsonLabelValue(m json.Marshaler) string {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%v", m)
+	}
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return s
+	}
+	return string(b)
+}
+
+// truncate shortens s to at most n bytes including the truncation marker,
+// without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	if n <= len(truncatedMarker) {
+		return truncatedMarker[:n]
+	}
+	cut := n - len(truncatedMarker)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedMarker
+}
+
+// SetLabelsFromContext sets a function that derives labels from the context
+// of entries logged with logrus.WithContext, e.g. a request ID. Labels
+// promoted from entry fields take precedence over context labels with the
+// same key.
+func (h *Hook) SetLabelsFromContext(fn func(context.Context) map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.contextLabels = fn
+}
+
+// addContextLabels merges the labels derived from ctx into labels.
+func (b *entryBuilder) addContextLabels(labels map[string]string, ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	for _, s := range b.contextStructs {
+		b.addStructLabels(labels, ctx.Value(s.key), s.fieldToLabel)
+	}
+	if b.contextLabels == nil {
+		return
+	}
+	for k, v := range b.contextLabels(ctx) {
+		labels[b.labelKey(k)] = truncate(v, b.maxLabelValueLength)
+	}
+}
+
+// contextStruct is a registration made with SetContextStructLabels.
+type contextStruct struct {
+	key          interface{}
+	fieldToLabel map[string]string
+}
+
+// SetContextStructLabels makes entries logged with logrus.WithContext get
+// labels from the struct, or pointer to struct, stored in their context
+// under key: each exported field named in fieldToLabel is written to the
+// label it maps to, converted as field values promoted to labels are.
+// Missing keys, nil pointers, values that aren't structs and unknown,
+// unexported or nil pointer fields are skipped. Labels from
+// SetLabelsFromContext take precedence. Calling it again with the same key
+// replaces its mapping; a nil mapping removes it.
+func (h *Hook) SetContextStructLabels(key interface{}, fieldToLabel map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	structs := make([]contextStruct, 0, len(h.contextStructs)+1)
+	for _, s := range h.contextStructs {
+		if s.key != key {
+			structs = append(structs, s)
+		}
+	}
+	if fieldToLabel != nil {
+		m := make(map[string]string, len(fieldToLabel))
+		for f, l := range fieldToLabel {
+			m[f] = l
+		}
+		structs = append(structs, contextStruct{key, m})
+	}
+	h.contextStructs = structs
+}
+
+// addStructLabels merges the labels mapped from the fields of v into labels.
+func (b *entryBuilder) addStructLabels(labels map[string]string, v interface{}, fieldToLabel map[string]string) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	for field, label := range fieldToLabel {
+		f := rv.FieldByName(field)
+		if !f.IsValid() || !f.CanInterface() || f.Kind() == reflect.Ptr && f.IsNil() {
+			continue
+		}
+		labels[b.labelKey(label)] = b.labelValue(f.Interface())
+	}
+}
+
+// SetSanitizeLabelKeys makes the hook rewrite label keys that Stackdriver
+// would reject: characters other than letters, digits and underscores are
+// replaced with "_", and keys that don't start with a letter are prefixed
+// with "l". When disabled, the default, invalid keys are sent unchanged and
+// reported to the error handler once per key. The prefix set with
+// SetLabelPrefix is neither checked nor rewritten.
+func (h *Hook) SetSanitizeLabelKeys(sanitize bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sanitizeLabelKeys = sanitize
+}
+
+// checkLabelKeys sanitizes or reports the invalid keys in labels.
+func (b *entryBuilder) checkLabelKeys(labels map[string]string) {
+	for k, v := range labels {
+		var prefix string
+		if strings.HasPrefix(k, b.labelPrefix) {
+			prefix = b.labelPrefix
+		}
+		if validLabelKey(k[len(prefix):]) {
+			continue
+		}
+		if !b.sanitizeLabelKeys {
+			if _, reported := b.h.invalidLabelKeys.LoadOrStore(k, true); !reported {
+				b.report(fmt.Errorf("invalid label key %q; use SetSanitizeLabelKeys", k))
+			}
+			continue
+		}
+		delete(labels, k)
+		key := prefix + sanitizeLabelKey(k[len(prefix):])
+		if _, ok := labels[key]; !ok {
+			labels[key] = v
+		}
+	}
+}
+
+// validLabelKey reports whether k starts with a letter and contains only
+// letters, digits and underscores.
+func validLabelKey(k string) bool {
+	for i, r := range k {
+		if !isLetter(r) && (i == 0 || !isDigit(r) && r != '_') {
+			return false
+		}
+	}
+	return k != ""
+}
+
+func sanitizeLabelKey(k string) string {
+	b := make([]byte, 0, len(k)+1)
+	if k == "" || !isLetter(rune(k[0])) {
+		b = append(b, 'l')
+	}
+	for _, r := range k {
+		if isLetter(r) || isDigit(r) {
+			b = append(b, byte(r))
+		} else {
+			b = append(b, '_')
+		}
+	}
+	return string(b)
+}
+
+func isLetter(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// SetMaxLabelsPerEntry sets the maximum number of labels on an entry, as a
+// safety valve against fields accidentally promoted to labels. Entries with
+// more labels keep the first n-1 in key order and a labels_truncated=true
+// label, and the first occurrence is reported to the error handler. Defaults
+// to DefaultMaxLabelsPerEntry; a value <= 0 disables the limit.
+func (h *Hook) SetMaxLabelsPerEntry(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxLabelsPerEntry = n
+}
+
+// limitLabels enforces the maximum number of labels.
+func (b *entryBuilder) limitLabels(labels map[string]string) {
+	if b.maxLabelsPerEntry <= 0 || len(labels) <= b.maxLabelsPerEntry {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[b.maxLabelsPerEntry-1:] {
+		delete(labels, k)
+	}
+	labels[b.labelKey(labelsTruncatedLabel)] = "true"
+	b.h.labelsTruncatedOnce.Do(func() {
+		b.report(fmt.Errorf("entry has %d labels, dropped all but %d", len(keys), b.maxLabelsPerEntry-1))
+	})
+}
@@ -0,0 +1,122 @@
+package stackrus
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// textID implements encoding.TextMarshaler only.
+type textID [2]byte
+
+func (id textID) MarshalText() ([]byte, error) { return []byte{'a' + id[0], 'a' + id[1]}, nil }
+
+// textAndString implements both encoding.TextMarshaler and fmt.Stringer.
+type textAndString struct{}
+
+func (textAndString) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func (textAndString) String() string { return "string" }
+
+// jsonOnly implements json.Marshaler only.
+type jsonOnly struct{ n int }
+
+func (j *jsonOnly) MarshalJSON() ([]byte, error) { return []byte(strconv.Itoa(j.n)), nil }
+
+func TestLabelValueTextMarshaler(t *testing.T) {
+	b := NewWithLogger(&fakeLogger{}).builder()
+	if got := b.labelValue(textID{1, 2}); got != "bc" {
+		t.Errorf("labelValue(TextMarshaler) = %q, want %q", got, "bc")
+	}
+	if got := b.labelValue(textAndString{}); got != "text" {
+		t.Errorf("labelValue(TextMarshaler and Stringer) = %q, want MarshalText's %q", got, "text")
+	}
+	var tm *time.Time
+	if got := b.labelValue(tm); got != "<nil>" {
+		t.Errorf("labelValue(nil *time.Time) = %q, want %q", got, "<nil>")
+	}
+	var jm *jsonOnly
+	if got := b.labelValue(jm); got != "<nil>" {
+		t.Errorf("labelValue(nil json.Marshaler) = %q, want %q", got, "<nil>")
+	}
+}
+
+func TestLabelValueNilStringer(t *testing.T) {
+	b := NewWithLogger(&fakeLogger{}).builder()
+	var u *url.URL
+	if got := b.labelValue(u); got != "<nil>" {
+		t.Errorf("labelValue(nil *url.URL) = %q, want %q", got, "<nil>")
+	}
+	if _, ok := parseDuration(u); ok {
+		t.Error("parseDuration(nil *url.URL) succeeded")
+	}
+}
+
+func TestDurationLabelFormatMillis(t *testing.T) {
+	h := NewWithLogger(&fakeLogger{})
+	h.SetDurationLabelFormat(DurationFormatMillis)
+	b := h.builder()
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{250 * time.Microsecond, "0.25"},
+		{1500 * time.Millisecond, "1500"},
+		{2500 * time.Millisecond, "2500"},
+		{3 * time.Minute, "180000"},
+	}
+	for _, tt := range tests {
+		if got := b.labelValue(tt.d); got != tt.want {
+			t.Errorf("labelValue(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestLabelPrefixIsNotSanitized(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var reported []error
+	h.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	h.SetLabelPrefix("checkout/")
+	h.SetLabels("user", "user-id")
+
+	fire(t, h, l, logrus.InfoLevel, "sanitize disabled", logrus.Fields{"user": "u"})
+	if got := l.last(t).Labels["checkout/user"]; got != "u" {
+		t.Errorf("label checkout/user = %q, want %q", got, "u")
+	}
+	if len(reported) != 0 {
+		t.Errorf("prefixed valid key reported as invalid: %v", reported)
+	}
+
+	h.SetSanitizeLabelKeys(true)
+	fire(t, h, l, logrus.InfoLevel, "sanitize enabled", logrus.Fields{"user": "u", "user-id": "1"})
+	labels := l.last(t).Labels
+	if labels["checkout/user"] != "u" || labels["checkout/user_id"] != "1" {
+		t.Errorf("labels = %v, want checkout/user and checkout/user_id", labels)
+	}
+}
+
+func TestLimitLabelsMarker(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var reported []error
+	h.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	h.SetLabelPrefix("app/")
+	h.SetMaxLabelsPerEntry(3)
+	h.SetLabels("a", "b", "c", "d")
+
+	fire(t, h, l, logrus.InfoLevel, "too many labels", logrus.Fields{"a": "1", "b": "2", "c": "3", "d": "4"})
+	labels := l.last(t).Labels
+	if len(labels) != 3 || labels["app/a"] != "1" || labels["app/b"] != "2" {
+		t.Errorf("labels = %v, want app/a, app/b and the truncation marker", labels)
+	}
+	if labels["app/labels_truncated"] != "true" {
+		t.Errorf("labels = %v, want app/labels_truncated=true", labels)
+	}
+	if len(reported) != 1 {
+		t.Errorf("got %d reported errors, want only the truncation: %v", len(reported), reported)
+	}
+}
@@ -0,0 +1,57 @@
+package stackrus
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var processStart = time.Now()
+
+// SetEmitLifecycleEvents makes Close log an Info entry "stackrus hook
+// shutting down" before closing. Use WithLifecycleEvents to also log
+// "stackrus hook initialized" when the hook is created. Both entries carry
+// hostname and pid labels and go through Fire, so the hook's other
+// configuration applies to them.
+func (h *Hook) SetEmitLifecycleEvents(emit bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lifecycleEvents = emit
+}
+
+// processLabels is a Labeler for the lifecycle entries.
+type processLabels struct{}
+
+func (processLabels) StackdriverLabels() map[string]string {
+	hostname, _ := os.Hostname()
+	return map[string]string{
+		"hostname": hostname,
+		"pid":      strconv.Itoa(os.Getpid()),
+	}
+}
+
+// emitLifecycleEvent logs msg through Fire if lifecycle events are enabled.
+// It calls Fire directly rather than going through a logrus logger, so it
+// works before the hook is added to one.
+func (h *Hook) emitLifecycleEvent(msg string) {
+	h.mu.RLock()
+	emit := h.lifecycleEvents
+	h.mu.RUnlock()
+	if !emit {
+		return
+	}
+	err := h.Fire(&logrus.Entry{
+		Data: logrus.Fields{
+			"process":      processLabels{},
+			"processStart": processStart.Format(time.RFC3339Nano),
+		},
+		Time:    time.Now(),
+		Level:   logrus.InfoLevel,
+		Message: msg,
+	})
+	if err != nil {
+		h.reportError(err)
+	}
+}
@@ -0,0 +1,183 @@
+package stackrus
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Reconfigure switches the hook to a new logger for logID, created from the
+// hook's client with opts, e.g. after a configuration reload. The swap
+// happens under the hook's lock, so concurrent Fire calls use either the old
+// or the new logger, never a mix. The old logger is flushed after the swap;
+// entries that an in-flight Fire hands to it after that are still delivered
+// when the client is closed. opts also apply to loggers created for dynamic
+// log IDs from then on.
+func (h *Hook) Reconfigure(logID string, opts ...logging.LoggerOption) error {
+	if h.client == nil {
+		return errors.New("stackrus: hook has no client to create a logger from")
+	}
+	logger := h.client.Logger(logID, opts...)
+
+	h.mu.Lock()
+	old := h.logger
+	h.logger = logger
+	h.loggerOpts = opts
+	h.mu.Unlock()
+
+	return old.Flush()
+}
+
+// Logger returns the hook's logger, for SDK operations the hook doesn't wrap.
+// Entries written to it directly bypass the hook's label and payload
+// processing. It returns nil if the hook writes to an EntryLogger that isn't
+// a *logging.Logger, or discards entries.
+func (h *Hook) Logger() *logging.Logger {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	l, _ := h.logger.(*logging.Logger)
+	return l
+}
+
+// SetDynamicLogIDKey sets the name of a field that overrides the log ID of
+// individual entries, e.g. to write each tenant's entries to its own log.
+// Loggers for these log IDs are created on first use with the same
+// LoggerOptions as the hook's logger, and are cached for the lifetime of the
+// hook. Each logger keeps its own buffer, so at most 100 are created; entries
+// for further log IDs go to the hook's log and the first is reported to the
+// error handler. The field is removed from the payload.
+func (h *Hook) SetDynamicLogIDKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dynamicLogIDKey = key
+}
+
+// SetSeverityLogID routes entries at level to the log logID, e.g. Error and
+// above to "error-log". Loggers are created and cached as for
+// SetDynamicLogIDKey, whose field takes precedence. An empty logID removes
+// the mapping, so that entries at level go to the hook's logger again.
+func (h *Hook) SetSeverityLogID(level logrus.Level, logID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := make(map[logrus.Level]string, len(h.severityLogIDs)+1)
+	for l, id := range h.severityLogIDs {
+		ids[l] = id
+	}
+	if logID == "" {
+		delete(ids, level)
+	} else {
+		ids[level] = logID
+	}
+	h.severityLogIDs = ids
+}
+
+// SetLogNameField sets the name of a field holding the full log name of an
+// entry, e.g. "projects/my-project/logs/audit". The SDK doesn't let entries
+// set logging.Entry.LogName themselves, so the entry is instead written
+// through a cached logger for the log ID, as with SetDynamicLogIDKey, whose
+// field it takes precedence over. Names that are malformed or outside the
+// hook's project are reported to the error handler and the entry goes to
+// its usual log, as do entries logged while the project ID is still being
+// detected; set it with SetProjectID to avoid this. The field is removed from
+// the payload.
+func (h *Hook) SetLogNameField(field string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logNameField = field
+	if field != "" {
+		h.needProjectID()
+	}
+}
+
+// logIDFromName returns the log ID of the full log name name, which must
+// belong to the hook's project.
+func (b *entryBuilder) logIDFromName(name string) (string, error) {
+	parts := strings.SplitN(name, "/", 4)
+	if len(parts) != 4 || parts[1] == "" || parts[2] != "logs" || parts[3] == "" {
+		return "", fmt.Errorf("invalid log name %q", name)
+	}
+	projectID, final := b.resolvedProjectID()
+	switch parts[0] {
+	case "projects":
+		if !final {
+			return "", fmt.Errorf("log name %q ignored, project ID not detected yet", name)
+		}
+		if parts[1] != projectID {
+			return "", fmt.Errorf("log name %q is outside project %q", name, projectID)
+		}
+	case "organizations", "folders", "billingAccounts":
+		return "", fmt.Errorf("log name %q is outside project %q", name, projectID)
+	default:
+		return "", fmt.Errorf("invalid log name %q", name)
+	}
+	logID, err := url.PathUnescape(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid log name %q: %v", name, err)
+	}
+	return logID, nil
+}
+
+// maxCachedLoggers bounds the loggers a hook creates for other log IDs than
+// its own.
+const maxCachedLoggers = 100
+
+// loggerFor returns the logger for logID, creating it if needed. An empty
+// logID, or a hook without a client, returns the hook's logger, as does a
+// new logID once maxCachedLoggers loggers were created.
+func (b *entryBuilder) loggerFor(logID string) EntryLogger {
+	if logID == "" || b.h.client == nil {
+		return b.logger
+	}
+	b.h.loggersMu.Lock()
+	l, ok := b.h.loggers[logID]
+	full := !ok && len(b.h.loggers) >= maxCachedLoggers
+	if !ok && !full {
+		if b.h.loggers == nil {
+			b.h.loggers = make(map[string]EntryLogger)
+		}
+		l = b.h.client.Logger(logID, b.loggerOpts...)
+		b.h.loggers[logID] = l
+	}
+	b.h.loggersMu.Unlock()
+
+	if full {
+		b.h.loggersFullOnce.Do(func() {
+			b.h.reportError(fmt.Errorf("more than %d log IDs, entries for %q and other new log IDs go to the hook's log", maxCachedLoggers, logID))
+		})
+		return b.logger
+	}
+	return l
+}
+
+// flushLoggers flushes the hook's logger, its mirrors and all cached loggers,
+// returning the first error.
+func (h *Hook) flushLoggers() error {
+	h.mu.RLock()
+	logger, mirrors := h.logger, h.mirrors
+	h.mu.RUnlock()
+
+	err := logger.Flush()
+	for _, m := range mirrors {
+		if ferr := m.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	// Flush without holding loggersMu, so that Fire can still route entries
+	// to cached loggers while they are flushed.
+	h.loggersMu.Lock()
+	loggers := make([]EntryLogger, 0, len(h.loggers))
+	for _, l := range h.loggers {
+		loggers = append(loggers, l)
+	}
+	h.loggersMu.Unlock()
+	for _, l := range loggers {
+		if ferr := l.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package stackrus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestLoggerForIsBounded(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var reported []error
+	h.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	h.client = &logging.Client{}
+	h.loggers = make(map[string]EntryLogger, maxCachedLoggers)
+	for i := 0; i < maxCachedLoggers; i++ {
+		h.loggers[fmt.Sprint("log", i)] = &fakeLogger{}
+	}
+
+	b := h.builder()
+	if got := b.loggerFor("log0"); got != h.loggers["log0"] {
+		t.Error("cached logger not returned")
+	}
+	for i := 0; i < 2; i++ {
+		if got := b.loggerFor("new"); got != l {
+			t.Errorf("loggerFor a new log ID past the limit = %v, want the hook's logger", got)
+		}
+	}
+	if len(h.loggers) != maxCachedLoggers {
+		t.Errorf("%d cached loggers, want %d", len(h.loggers), maxCachedLoggers)
+	}
+	if len(reported) != 1 {
+		t.Errorf("got %d reported errors, want 1: %v", len(reported), reported)
+	}
+}
+
+// flushingLogger is a fakeLogger that calls onFlush when it is flushed.
+type flushingLogger struct {
+	fakeLogger
+	onFlush func()
+}
+
+func (l *flushingLogger) Flush() error {
+	l.onFlush()
+	return l.fakeLogger.Flush()
+}
+
+func TestFlushDoesNotBlockLoggerFor(t *testing.T) {
+	h := NewWithLogger(&fakeLogger{})
+	h.client = &logging.Client{}
+	cached := &flushingLogger{}
+	cached.onFlush = func() {
+		b := h.builder()
+		if got := b.loggerFor("cached"); got != cached {
+			t.Errorf("loggerFor during Flush = %v, want the cached logger", got)
+		}
+	}
+	h.loggers = map[string]EntryLogger{"cached": cached}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Flush()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Flush deadlocked routing an entry to a cached logger")
+	}
+}
@@ -8,7 +8,7 @@ An example:
 	"context"
 
 	"cloud.google.com/go/logging"
-    log "github.com/Sirupsen/logrus"
+    log "github.com/sirupsen/logrus"
 	"github.com/recursionpharma/stackrus"
   )
   func main() {
@@ -30,25 +30,295 @@ package stackrus
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"cloud.google.com/go/logging"
-	"github.com/Sirupsen/logrus"
+	"github.com/sirupsen/logrus"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
 )
 
+// EntryLogger is the subset of *logging.Logger used by the hook.
+type EntryLogger interface {
+	Log(e logging.Entry)
+	LogSync(ctx context.Context, e logging.Entry) error
+	Flush() error
+}
+
+var _ EntryLogger = (*logging.Logger)(nil)
+
+// ErrNilClient is returned by NewHookE when it is given a nil client.
+var ErrNilClient = errors.New("stackrus: nil logging client")
+
+// discardLogger is an EntryLogger that drops all entries. It backs hooks
+// created by NewDiscard.
+type discardLogger struct{}
+
+func (discardLogger) Log(logging.Entry)                            {}
+func (discardLogger) LogSync(context.Context, logging.Entry) error { return nil }
+func (discardLogger) Flush() error                                 { return nil }
+
 type Hook struct {
-	client *logging.Client
-	logger *logging.Logger
-	labels map[string]bool
+	// counters is kept first so that it is 64-bit aligned for atomic
+	// operations on 32-bit platforms.
+	counters hookCounters
+
+	// mu guards the hook's configuration. Fire copies it while holding mu
+	// for reading and builds the entry from the copy, so that user code
+	// called while building never runs under the lock. The setters hold mu
+	// for writing.
+	mu sync.RWMutex
+	hookConfig
+
+	client     *logging.Client
+	ownsClient bool
+	discard    bool
+	disabled   int32
+	optErr     error
+	closeOnce  sync.Once
+	closed     int32
+
+	loggersMu       sync.Mutex
+	loggers         map[string]EntryLogger
+	loggersFullOnce sync.Once
+
+	flusherMu   sync.Mutex
+	flusherStop chan struct{}
+	flusherDone chan struct{}
+	flushing    int32
+
+	errorHandler  atomic.Value // func(error)
+	clientOnError func(error)
+	removeRoutes  []func()
+
+	fallbackMu sync.Mutex
+	fallback   io.Writer
 
-	syncCtx context.Context
-	sync    bool
+	dryRunMu sync.Mutex   // serializes writes to the dry-run writer
+	dryRun   atomic.Value // dryRunWriter
+
+	dedupMu   sync.Mutex
+	dedupLast *dedupState
+
+	noProjectIDOnce     sync.Once
+	messageKeyOnce      sync.Once
+	contextKeyOnce      sync.Once
+	labelsTruncatedOnce sync.Once
+	invalidLabelKeys    sync.Map
 }
 
-func initHook(sync bool, client *logging.Client, logID string, opts ...logging.LoggerOption) *Hook {
-	h := &Hook{client: client, sync: sync, syncCtx: context.Background()}
-	h.logger = h.client.Logger(logID, opts...)
-	h.labels = make(map[string]bool)
+// hookConfig holds the settings of a Hook. Since Fire reads copies of it
+// without holding the hook's lock, setters must replace its maps and slices
+// rather than modify them.
+type hookConfig struct {
+	logger     EntryLogger
+	loggerOpts []logging.LoggerOption
+
+	dynamicLogIDKey string
+	severityLogIDs  map[logrus.Level]string
+	logNameField    string
+	pingLogID       string
+	writerLevel     logrus.Level
+	mirrors         []EntryLogger
+	flushEveryN     int
+	lifecycleEvents bool
+
+	levels                []logrus.Level
+	severityMapper        func(logrus.Level) logging.Severity
+	severityOverrideField string
+	sampleRates           map[logrus.Level]float64
+	sampler               func(*logrus.Entry) bool
+	consistentSampleField string
+	consistentSampleRate  float64
+	filter                func(*logrus.Entry) bool
+	respectCancellation   bool
+
+	clock       func() time.Time
+	dedupWindow time.Duration
+
+	labels               map[string]bool
+	allFieldsAsLabels    bool
+	duplicatedLabels     map[string]bool
+	keepLabelerFields    bool
+	severityLabels       map[logrus.Level]map[string]string
+	defaultLabels        map[string]string
+	buildLabels          map[string]string
+	componentName        string
+	maxLabelValueLength  int
+	maxLabelsPerEntry    int
+	durationLabelFormat  DurationFormat
+	labelPrefix          string
+	contextLabels        func(context.Context) map[string]string
+	contextStructs       []contextStruct
+	redacted             map[string]bool
+	redactionPlaceholder string
+	fieldKeyMap          map[string]string
+	sanitizeLabelKeys    bool
+
+	projectID          string
+	traceContextKey    interface{}
+	spanIDKey          string
+	spanIDContextKey   interface{}
+	traceHeaderField   string
+	traceFormat        TraceFormat
+	spanExtractor      func(context.Context) (traceID, spanID string, sampled bool, ok bool)
+	insertIDKey        string
+	requestIDField     string
+	noRequestIDTrace   bool
+	httpFields         *HTTPRequestFields
+	operationFields    OperationFields
+	reportCaller       bool
+	resource           *mrpb.MonitoredResource
+	resourceLabels     map[string]string
+	autoDetectResource bool
+
+	errorKey       string
+	errorReporting bool
+	serviceName    string
+	serviceVersion string
+
+	messageKey          string
+	messageFieldKey     string
+	severityInPayload   bool
+	severityPayloadKey  string
+	textPayload         bool
+	flatten             bool
+	flattenSep          string
+	payloadNamespace    string
+	payloadFields       map[string]bool
+	omitEmpty           bool
+	omitEmptyMessage    bool
+	normalizeTimes      bool
+	payloadBuilder      func(*logrus.Entry) interface{}
+	fieldEncoder        func(key string, value interface{}) (interface{}, bool)
+	maxPayloadBytes     int
+	largeFieldThreshold int
+	largeFieldHandler   func(key string, value interface{}) (replacement interface{})
+
+	syncCtx           context.Context
+	sync              bool
+	syncLevels        map[logrus.Level]bool
+	syncAttempts      int
+	syncBackoff       time.Duration
+	syncTimeout       time.Duration
+	flushOnFatal      bool
+	flushOnPanic      bool
+	fatalFlushTimeout time.Duration
+	shutdownTimeout   time.Duration
+	noShutdownReraise bool
+}
+
+const defaultMessageKey = "message"
+
+// NewHook returns a logrus hook for the given client, configured by opts.
+// Without WithSync, logs are relayed to the Stackdriver API asynchronously.
+// If client is nil, the returned hook discards all entries; use NewHookE to
+// get an error instead.
+func NewHook(client *logging.Client, logID string, opts ...Option) *Hook {
+	if client == nil {
+		h := NewDiscard()
+		h.reportError(errors.New("nil logging client, entries will be discarded"))
+		return h
+	}
+	h := newHook(client, opts)
+	if h.optErr != nil {
+		h.reportError(h.optErr)
+	}
+	h.attachClient(logID)
+	return h
+}
+
+// attachClient creates the hook's logger for logID from its client and
+// routes the client's errors through the hook.
+func (h *Hook) attachClient(logID string) {
+	prev, remove := routeClientErrors(h.client, h.clientError)
+	h.clientOnError = prev
+	h.removeRoutes = append(h.removeRoutes, remove)
+	h.logger = h.client.Logger(logID, h.loggerOpts...)
+	h.emitLifecycleEvent("stackrus hook initialized")
+}
+
+// NewDiscard returns a hook that discards all entries and needs no client,
+// for local development and tests. Flush and Close do nothing.
+func NewDiscard() *Hook {
+	h := NewWithLogger(discardLogger{})
+	h.discard = true
+	return h
+}
+
+// NewHookE is like NewHook, but returns ErrNilClient if client is nil, or an
+// error if an option was given an invalid value. NewHook reports such
+// options to the error handler and ignores them.
+func NewHookE(client *logging.Client, logID string, opts ...Option) (*Hook, error) {
+	if client == nil {
+		return nil, ErrNilClient
+	}
+	h := newHook(client, opts)
+	if h.optErr != nil {
+		return nil, fmt.Errorf("stackrus: %v", h.optErr)
+	}
+	h.attachClient(logID)
+	return h, nil
+}
+
+// NewWithLogger returns a logrus hook that writes entries to logger instead
+// of a logger created from a client, e.g. a fake that records entries in
+// tests. Since the hook has no client, Close only flushes the logger and
+// per-entry log IDs are ignored, as are options configuring the logger, such
+// as WithCommonLabels, WithResource and the WithBatch options; they are
+// reported to the error handler, as are invalid options.
+func NewWithLogger(logger EntryLogger, opts ...Option) *Hook {
+	h := newHook(nil, opts)
+	h.ownsClient = false
+	h.logger = logger
+	if h.optErr != nil {
+		h.reportError(h.optErr)
+	}
+	if len(h.loggerOpts) > 0 {
+		h.reportError(errors.New("logger options are ignored by a hook without a client"))
+	}
+	h.emitLifecycleEvent("stackrus hook initialized")
+	return h
+}
+
+func newHook(client *logging.Client, opts []Option) *Hook {
+	h := &Hook{
+		client:     client,
+		ownsClient: true,
+		hookConfig: hookConfig{
+			syncCtx:               context.Background(),
+			clock:                 time.Now,
+			labels:                make(map[string]bool),
+			spanIDKey:             "spanID",
+			insertIDKey:           "insertID",
+			traceFormat:           TraceFormatCloud,
+			errorKey:              logrus.ErrorKey,
+			operationFields:       DefaultOperationFields,
+			messageKey:            defaultMessageKey,
+			messageFieldKey:       "message_field",
+			severityPayloadKey:    "severity",
+			severityOverrideField: "severity",
+			flushOnFatal:          true,
+			flushOnPanic:          true,
+			writerLevel:           logrus.InfoLevel,
+			fatalFlushTimeout:     DefaultFatalFlushTimeout,
+			shutdownTimeout:       DefaultShutdownTimeout,
+			flattenSep:            ".",
+			maxLabelValueLength:   DefaultMaxLabelValueLength,
+			maxLabelsPerEntry:     DefaultMaxLabelsPerEntry,
+		},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
 	return h
 }
 
@@ -57,7 +327,7 @@ func initHook(sync bool, client *logging.Client, logID string, opts ...logging.L
 // responsibility to call client.Close() so that buffered logs get
 // written before the end of the program!
 func New(client *logging.Client, logID string, opts ...logging.LoggerOption) *Hook {
-	return initHook(false, client, logID, opts...)
+	return NewHook(client, logID, WithLoggerOptions(opts...))
 }
 
 // NewSync returns a logrus hook for the given client and
@@ -66,23 +336,330 @@ func New(client *logging.Client, logID string, opts ...logging.LoggerOption) *Ho
 // In order to use a non-background context for a LogSync entry, call SetSyncContext on the
 // returned hook.
 func NewSync(client *logging.Client, logID string, opts ...logging.LoggerOption) *Hook {
-	return initHook(true, client, logID, opts...)
+	return NewHook(client, logID, WithSync(), WithLoggerOptions(opts...))
+}
+
+// Flush blocks until all buffered entries have been sent to Stackdriver,
+// without closing the client. It returns any error reported by the logger.
+func (h *Hook) Flush() error {
+	return h.flushLoggers()
+}
+
+// NewWithSharedClient is like New, but the client is assumed to be used by
+// other code, so Close only flushes the hook's logger instead of closing the
+// client.
+func NewWithSharedClient(client *logging.Client, logID string, opts ...logging.LoggerOption) *Hook {
+	return NewHook(client, logID, WithSharedClient(), WithLoggerOptions(opts...))
+}
+
+// NewSyncWithSharedClient is the synchronous counterpart of NewWithSharedClient.
+func NewSyncWithSharedClient(client *logging.Client, logID string, opts ...logging.LoggerOption) *Hook {
+	return NewHook(client, logID, WithSync(), WithSharedClient(), WithLoggerOptions(opts...))
+}
+
+// NewFromLogger returns a logrus hook that relays logs asynchronously to an
+// already configured logger. The hook owns no client, so Close only flushes
+// the logger and per-entry log IDs are ignored. If logger is nil, the
+// returned hook discards all entries.
+func NewFromLogger(logger *logging.Logger) *Hook {
+	return newFromLogger(logger)
+}
+
+// NewSyncFromLogger is the synchronous counterpart of NewFromLogger.
+func NewSyncFromLogger(logger *logging.Logger) *Hook {
+	return newFromLogger(logger, WithSync())
+}
+
+func newFromLogger(logger *logging.Logger, opts ...Option) *Hook {
+	if logger == nil {
+		h := NewDiscard()
+		h.reportError(errors.New("nil logger, entries will be discarded"))
+		return h
+	}
+	return NewWithLogger(logger, opts...)
+}
+
+// Close flushes the hook's logger and closes the client, unless the hook was
+// created with a shared client, in which case it only flushes. Entries fired
+// after Close are dropped, and later calls to Close do nothing.
+func (h *Hook) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		h.emitLifecycleEvent("stackrus hook shutting down")
+		atomic.StoreInt32(&h.closed, 1)
+		h.mu.Lock()
+		for _, remove := range h.removeRoutes {
+			remove()
+		}
+		h.removeRoutes = nil
+		h.mu.Unlock()
+		h.StopPeriodicFlush()
+		h.flushDedup()
+		err = h.flushLoggers()
+		if h.ownsClient {
+			if cerr := h.client.Close(); err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
 }
 
 func (h *Hook) SetSyncContext(ctx context.Context) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.syncCtx = ctx
 }
 
 func (h *Hook) SetLabels(labels ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.labels = make(map[string]bool)
 	for _, label := range labels {
 		h.labels[label] = true
 	}
 }
 
+// SetSeverityMapper replaces the default logrus to Stackdriver level mapping
+// used by Fire. If the mapper returns a severity that is not one of the
+// logging package's constants, logging.Default is used instead.
+func (h *Hook) SetSeverityMapper(mapper func(logrus.Level) logging.Severity) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.severityMapper = mapper
+}
+
+func (b *entryBuilder) severity(l logrus.Level) logging.Severity {
+	if b.severityMapper == nil {
+		return mapLogrusToStackdriverLevel(l)
+	}
+	s := b.severityMapper(l)
+	switch s {
+	case logging.Default, logging.Debug, logging.Info, logging.Notice, logging.Warning,
+		logging.Error, logging.Critical, logging.Alert, logging.Emergency:
+		return s
+	default:
+		return logging.Default
+	}
+}
+
+// SetSeverityOverrideField sets the name of a field whose value, one of the
+// Stackdriver severity names such as "NOTICE" in any case, overrides the
+// severity mapped from the entry's level. Defaults to "severity"; an empty
+// name disables overrides. The field is removed from the payload. Unknown
+// values are reported to the error handler and the mapped severity is used.
+func (h *Hook) SetSeverityOverrideField(field string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.severityOverrideField = field
+}
+
+// applySeverityOverride sets the entry's severity from the severity override
+// field in data, removing the field.
+func (b *entryBuilder) applySeverityOverride(entry *logging.Entry, data map[string]interface{}) {
+	if b.severityOverrideField == "" {
+		return
+	}
+	v, ok := data[b.severityOverrideField]
+	if !ok {
+		return
+	}
+	delete(data, b.severityOverrideField)
+	name, _ := v.(string)
+	s := logging.ParseSeverity(name)
+	if s == logging.Default && !strings.EqualFold(name, "default") {
+		b.report(fmt.Errorf("unknown severity %v in field %q, using %v", v, b.severityOverrideField, entry.Severity))
+		return
+	}
+	entry.Severity = s
+}
+
+// SetMessageKey sets the payload key that holds the log message. Defaults to
+// "message"; an empty key restores the default. The message always wins
+// over a field with the same name, which is moved as set by
+// SetMessageFieldKey.
+func (h *Hook) SetMessageKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if key == "" {
+		key = defaultMessageKey
+	}
+	h.messageKey = key
+}
+
+// SetMessageFieldKey sets the payload key a field colliding with the message
+// key is moved to. Defaults to "message_field". With an empty key, or if the
+// entry also has a field with that key, the colliding field is dropped and
+// the first occurrence is reported to the error handler.
+func (h *Hook) SetMessageFieldKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messageFieldKey = key
+}
+
+// SetErrorHandler sets a function that is called with errors from the
+// client's background uploader, such as entries rejected by Stackdriver, and
+// with problems the hook encounters while building entries. It only applies
+// to async mode: in sync mode, delivery errors are returned from Fire.
+// When unset, errors go to the client's previous OnError function.
+//
+// The hook takes over the client's OnError function when it is created, so
+// create hooks before the client is used. Since the client doesn't say which
+// logger an error came from, every hook or mirror sharing a client gets its
+// errors, and the previous OnError function is only called when none of them
+// has an error handler.
+func (h *Hook) SetErrorHandler(handler func(error)) {
+	h.errorHandler.Store(handler)
+}
+
+// clientError handles the errors of the hook's client, reporting whether
+// the error handler was called.
+func (h *Hook) clientError(err error) bool {
+	atomic.AddUint64(&h.counters.failed, 1)
+	h.writeFallbackError(err)
+	return h.handleError(err)
+}
+
+// handleError passes err to the error handler, reporting whether one is set.
+func (h *Hook) handleError(err error) bool {
+	handler, _ := h.errorHandler.Load().(func(error))
+	if handler == nil {
+		return false
+	}
+	handler(err)
+	return true
+}
+
+// reportError reports errors encountered while building entries to the
+// error handler, or else the client's previous OnError function. While the
+// standard logger writes through a hook, errors go to stderr instead of the
+// previous OnError function, since the client's default one uses the
+// standard logger.
+func (h *Hook) reportError(err error) {
+	switch {
+	case h.handleError(err):
+	case h.clientOnError != nil && !logsToHook():
+		h.clientOnError(err)
+	default:
+		logError(err)
+	}
+}
+
+// logsToHook reports whether the standard logger writes through a hook,
+// where an error written with it could cause another one.
+func logsToHook() bool {
+	_, ok := log.Writer().(*hookWriter)
+	return ok
+}
+
+// logError writes err with the standard logger, or to stderr if the standard
+// logger writes through a hook.
+func logError(err error) {
+	if logsToHook() {
+		fmt.Fprintf(os.Stderr, "stackrus: %v\n", err)
+		return
+	}
+	log.Printf("stackrus: %v", err)
+}
+
+// SetTextPayload makes entries without any payload fields besides the message
+// be sent as a textPayload containing just the message. Entries with other
+// payload fields are still sent as a jsonPayload.
+func (h *Hook) SetTextPayload(textPayload bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.textPayload = textPayload
+}
+
+// SetClock sets the function used to timestamp entries whose time is zero,
+// e.g. entries constructed by hand. Defaults to time.Now; a nil clock
+// restores the default.
+func (h *Hook) SetClock(clock func() time.Time) {
+	if clock == nil {
+		clock = time.Now
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clock = clock
+}
+
+func (b *entryBuilder) timestamp(e *logrus.Entry) time.Time {
+	if e.Time.IsZero() {
+		return b.clock()
+	}
+	return e.Time
+}
+
+// SetReportCaller enables translating the logrus caller into the entry's
+// SourceLocation. The logrus logger must also have SetReportCaller(true)
+// for a caller to be available.
+func (h *Hook) SetReportCaller(reportCaller bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reportCaller = reportCaller
+}
+
+func (b *entryBuilder) sourceLocation(e *logrus.Entry) *logpb.LogEntrySourceLocation {
+	if !b.reportCaller || e.Caller == nil {
+		return nil
+	}
+	return &logpb.LogEntrySourceLocation{
+		File:     e.Caller.File,
+		Line:     int64(e.Caller.Line),
+		Function: e.Caller.Function,
+	}
+}
+
+// SetDefaultLabels sets labels that are attached to every entry. Labels
+// promoted from entry fields take precedence over defaults with the same key.
+// The map is copied, so later changes by the caller have no effect.
+func (h *Hook) SetDefaultLabels(labels map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	defaults := make(map[string]string, len(labels))
+	for k, v := range labels {
+		defaults[k] = v
+	}
+	h.defaultLabels = defaults
+}
+
+// SetMonitoredResource sets the monitored resource attached to every entry.
+// When unset, the logging client's default resource is used.
+func (h *Hook) SetMonitoredResource(resource *mrpb.MonitoredResource) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resource = resource
+}
+
+// SetInsertIDKey sets the name of the field whose value is used as the
+// entry's InsertID, which Stackdriver uses to deduplicate entries. Defaults
+// to "insertID". The field is removed from the payload.
+func (h *Hook) SetInsertIDKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.insertIDKey = key
+}
+
+// popField removes key from data and returns its value formatted as a
+// string. The boolean is false if the key is empty or absent.
+func popField(data map[string]interface{}, key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", false
+	}
+	delete(data, key)
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	return fmt.Sprintf("%v", v), true
+}
+
 func mapLogrusToStackdriverLevel(l logrus.Level) logging.Severity {
 	switch l {
-	case logrus.DebugLevel:
+	case logrus.TraceLevel, logrus.DebugLevel:
 		return logging.Debug
 	case logrus.InfoLevel:
 		return logging.Info
@@ -95,54 +672,262 @@ func mapLogrusToStackdriverLevel(l logrus.Level) logging.Severity {
 	case logrus.PanicLevel:
 		return logging.Alert
 	default:
-		return logging.Debug // Should never happen
+		return logging.Default
 	}
 }
 
-// Levels returns the logrus levels that this hook is applied to.
-// TODO: Allow configuration.
+// SetLevels restricts the hook to the given logrus levels. logrus reads
+// the levels when the hook is added, so this must be called before AddHook.
+func (h *Hook) SetLevels(levels ...logrus.Level) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.levels = levels
+}
+
+// Levels returns the logrus levels that this hook is applied to, which
+// defaults to logrus.AllLevels unless SetLevels has been called.
 func (h *Hook) Levels() []logrus.Level {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.levels != nil {
+		return h.levels
+	}
 	return logrus.AllLevels
 }
 
+// hasLevel reports whether the hook fires for entries at level.
+func (b *entryBuilder) hasLevel(level logrus.Level) bool {
+	if b.levels == nil {
+		return true
+	}
+	for _, l := range b.levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
 // Fire sends the log entry to Stackdriver either synchrounously or asynchronously, depending
 // on how the hook was instantiated. Levels from Logrus are mapped to the Stackdriver API levels
 // (https://godoc.org/cloud.google.com/go/logging#pkg-constants) as follows:
 // [logrus Level] -> [Stackdriver Level]
+// Trace -> Debug
 // Debug, Info, Warning, Error -> (same)
 // Fatal -> Critical
 // Panic -> Alert
+// The mapping can be replaced with SetSeverityMapper.
 func (h *Hook) Fire(e *logrus.Entry) error {
-	payload := make(map[string]interface{})
-	labels := make(map[string]string)
+	return h.fire(e, false)
+}
+
+// fire sends e, synchronously if forceSync is set.
+func (h *Hook) fire(e *logrus.Entry, forceSync bool) error {
+	if h.discard || h.muted(1) {
+		return nil
+	}
+	b := h.builder()
+	if !b.shouldSend(e) {
+		return nil
+	}
+	entry, logID, err := b.buildEntry(e)
+	b.reportErrors()
+	if err != nil {
+		atomic.AddUint64(&h.counters.dropped, 1)
+		h.reportError(err)
+		return nil
+	}
+	logger := b.loggerFor(logID)
+	isSync, syncs := forceSync || b.sendsSync(e.Level), b.syncSettings()
+	final, finalTimeout := b.sendsFinal(e), b.fatalFlushTimeout
+	dedupWindow, repeatedKey, clock := b.dedupWindow, b.labelKey(repeatedLabel), b.clock
+	mirrors, flushEveryN := b.mirrors, b.flushEveryN
+
+	if !final && dedupWindow > 0 && h.deduplicate(e, &dedupState{
+		entry:       entry,
+		logID:       logID,
+		logger:      logger,
+		sync:        isSync,
+		syncs:       syncs,
+		repeatedKey: repeatedKey,
+		clock:       clock,
+	}, dedupWindow) {
+		return nil
+	}
+	if h.writeDryRun(entry, logID) {
+		return nil
+	}
+	mirror(mirrors, entry)
+	switch {
+	case final:
+		err = h.logFinal(logger, entry, finalTimeout)
+	case isSync:
+		err = syncs.logSync(logger, entry)
+	default:
+		logger.Log(entry)
+		h.countEnqueued(flushEveryN)
+	}
+	if err != nil {
+		atomic.AddUint64(&h.counters.failed, 1)
+		h.writeFallback(e)
+		return err
+	}
+	atomic.AddUint64(&h.counters.sent, 1)
+	return nil
+}
+
+// entryBuilder builds entries from a copy of a hook's configuration, so that
+// the user code it calls, such as filters, Labelers and encoders, runs
+// without the hook's lock held. Problems found while building are collected
+// and reported once building is done, since the error handler may log
+// through the hook again.
+type entryBuilder struct {
+	hookConfig
+	h    *Hook
+	errs []error
+}
+
+// builder returns an entry builder for the hook's current configuration.
+func (h *Hook) builder() entryBuilder {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return entryBuilder{hookConfig: h.hookConfig, h: h}
+}
+
+// report records err to be reported by reportErrors.
+func (b *entryBuilder) report(err error) {
+	b.errs = append(b.errs, err)
+}
+
+// reportErrors passes the recorded errors to the hook's error handler.
+func (b *entryBuilder) reportErrors() {
+	for _, err := range b.errs {
+		b.h.reportError(err)
+	}
+	b.errs = nil
+}
+
+// shouldSend reports whether e should be sent at all.
+func (b *entryBuilder) shouldSend(e *logrus.Entry) bool {
+	if b.filter != nil && !b.filter(e) {
+		return false
+	}
+	if b.canceled(e) {
+		atomic.AddUint64(&b.h.counters.dropped, 1)
+		return false
+	}
+	if !b.sample(e) {
+		atomic.AddUint64(&b.h.counters.sampled, 1)
+		return false
+	}
+	return true
+}
 
-	payload["message"] = e.Message
+// dataPool holds the scratch maps buildEntry copies entry fields into. The
+// payload and labels maps can't be pooled, since the logger retains them
+// until the entry is sent in async mode.
+var dataPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]interface{})
+	},
+}
+
+func putData(data map[string]interface{}) {
+	for k := range data {
+		delete(data, k)
+	}
+	dataPool.Put(data)
+}
+
+// buildEntry translates a logrus entry into a Stackdriver entry, and returns
+// the log ID the entry should be written to if it isn't the hook's. An error
+// means the entry can't be sent and should be dropped.
+func (b *entryBuilder) buildEntry(e *logrus.Entry) (logging.Entry, string, error) {
+	labels := make(map[string]string, len(b.defaultLabels))
+	for k, v := range b.defaultLabels {
+		labels[b.labelKey(k)] = v
+	}
+	b.addContextLabels(labels, e.Context)
 
+	data := dataPool.Get().(map[string]interface{})
+	defer putData(data)
 	for k, v := range e.Data {
-		if h.labels[k] {
-			switch t := v.(type) {
-			case string:
-				labels[k] = t
-			default:
-				labels[k] = fmt.Sprintf("%v", t)
-			}
-		} else if k == "error" {
-			payload[k] = fmt.Sprintf("%v", v)
+		data[k] = v
+	}
+	b.redact(data)
+	b.renameFields(data)
+
+	entry := logging.Entry{
+		Timestamp:      b.timestamp(e),
+		Severity:       b.severity(e.Level),
+		Labels:         labels,
+		Trace:          b.traceFromContext(e.Context),
+		SpanID:         b.extractSpanID(e.Context, data),
+		HTTPRequest:    b.extractHTTPRequest(data),
+		SourceLocation: b.sourceLocation(e),
+		Resource:       b.entryResource(),
+	}
+	b.applySeverityOverride(&entry, data)
+	b.applySpanExtractor(&entry, e.Context)
+	b.applyTraceHeader(&entry, data)
+	b.applyTraceFields(&entry, data)
+	b.applyRequestID(&entry, labels, data)
+	entry.InsertID, _ = popField(data, b.insertIDKey)
+	entry.Operation = b.extractOperation(data)
+	logID, _ := popField(data, b.dynamicLogIDKey)
+	if name, ok := popField(data, b.logNameField); ok {
+		if id, err := b.logIDFromName(name); err != nil {
+			b.report(err)
 		} else {
-			payload[k] = v
+			logID = id
 		}
 	}
+	if logID == "" {
+		logID = b.severityLogIDs[e.Level]
+	}
 
-	entry := logging.Entry{
-		Timestamp: e.Time,
-		Severity:  mapLogrusToStackdriverLevel(e.Level),
-		Payload:   payload,
-		Labels:    labels,
+	for k, v := range data {
+		if b.isLabel(k) {
+			labels[b.labelKey(k)] = b.labelValue(v)
+			delete(data, k)
+		} else if b.duplicatedLabels[k] {
+			labels[b.labelKey(k)] = b.labelValue(v)
+		} else if l, ok := v.(Labeler); ok {
+			b.addLabelerLabels(labels, l)
+			if !b.keepLabelerFields {
+				delete(data, k)
+			}
+		}
+	}
+	for k, v := range b.buildLabels {
+		labels[b.labelKey(k)] = v
+	}
+	if b.componentName != "" {
+		labels[b.labelKey(componentLabel)] = b.componentName
+	}
+	for k, v := range b.severityLabels[e.Level] {
+		labels[b.labelKey(k)] = v
 	}
+	if b.omitEmpty {
+		for k, v := range labels {
+			if v == "" {
+				delete(labels, k)
+			}
+		}
+	}
+	b.limitLabels(labels)
+	b.checkLabelKeys(labels)
 
-	if h.sync {
-		return h.logger.LogSync(h.syncCtx, entry)
+	var payload interface{}
+	if b.payloadBuilder != nil {
+		payload = b.payloadBuilder(e)
+	} else {
+		payload = b.buildPayload(e, data)
 	}
-	h.logger.Log(entry)
-	return nil
+	payload, err := b.limitPayload(payload)
+	if err != nil {
+		return logging.Entry{}, "", err
+	}
+	entry.Payload = payload
+	return entry, logID, nil
 }
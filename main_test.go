@@ -0,0 +1,195 @@
+package stackrus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeLogger is an EntryLogger that records the entries it is given.
+type fakeLogger struct {
+	mu      sync.Mutex
+	entries []logging.Entry
+	syncs   int
+	flushes int
+}
+
+func (l *fakeLogger) Log(e logging.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+func (l *fakeLogger) LogSync(ctx context.Context, e logging.Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	l.syncs++
+	return nil
+}
+
+func (l *fakeLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes++
+	return nil
+}
+
+// last returns the most recent entry, failing t if there is none.
+func (l *fakeLogger) last(t *testing.T) logging.Entry {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		t.Fatal("no entries logged")
+	}
+	return l.entries[len(l.entries)-1]
+}
+
+// fire sends an entry with msg and fields at level through h, returning the
+// payload that was logged.
+func fire(t *testing.T, h *Hook, l *fakeLogger, level logrus.Level, msg string, fields logrus.Fields) map[string]interface{} {
+	t.Helper()
+	data := logrus.Fields{}
+	for k, v := range fields {
+		data[k] = v
+	}
+	if err := h.Fire(&logrus.Entry{Data: data, Time: time.Now(), Level: level, Message: msg}); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	payload, ok := l.last(t).Payload.(map[string]interface{})
+	if !ok {
+		t.Fatalf("payload is %T, want map[string]interface{}", l.last(t).Payload)
+	}
+	return payload
+}
+
+func TestMapLogrusToStackdriverLevel(t *testing.T) {
+	tests := []struct {
+		level logrus.Level
+		want  logging.Severity
+	}{
+		{logrus.TraceLevel, logging.Debug},
+		{logrus.DebugLevel, logging.Debug},
+		{logrus.InfoLevel, logging.Info},
+		{logrus.WarnLevel, logging.Warning},
+		{logrus.ErrorLevel, logging.Error},
+		{logrus.FatalLevel, logging.Critical},
+		{logrus.PanicLevel, logging.Alert},
+	}
+	for _, tt := range tests {
+		if got := mapLogrusToStackdriverLevel(tt.level); got != tt.want {
+			t.Errorf("mapLogrusToStackdriverLevel(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestFireConcurrentWithSetters(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.SetLabels("user", fmt.Sprintf("label%d", j))
+				h.SetSampleRate(logrus.DebugLevel, 1)
+				h.SetSeverityLogID(logrus.ErrorLevel, fmt.Sprintf("errors%d", i))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Fire(&logrus.Entry{
+					Data:    logrus.Fields{"user": "u", "n": j},
+					Time:    time.Now(),
+					Level:   logrus.InfoLevel,
+					Message: "concurrent",
+				})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestErrorHandlerMayLog(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(h)
+	h.SetErrorHandler(func(err error) {
+		logger.WithField("reported", err.Error()).Warn("stackrus error")
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				h.SetLabels("user")
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			logger.WithField("severity", "bogus").Info("unknown severity")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Fire deadlocked reporting an error through the hook")
+	}
+}
+
+func TestNewHookNilClient(t *testing.T) {
+	h := NewHook(nil, "log")
+	if h == nil {
+		t.Fatal("NewHook(nil) = nil, want a discarding hook")
+	}
+	if !h.discard {
+		t.Error("NewHook(nil) returned a hook that doesn't discard entries")
+	}
+	if err := h.Fire(&logrus.Entry{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel}); err != nil {
+		t.Errorf("Fire on discarding hook: %v", err)
+	}
+
+	h, err := NewHookE(nil, "log")
+	if !errors.Is(err, ErrNilClient) {
+		t.Errorf("NewHookE(nil) error = %v, want ErrNilClient", err)
+	}
+	if h != nil {
+		t.Errorf("NewHookE(nil) hook = %v, want nil", h)
+	}
+}
+
+func BenchmarkFire(b *testing.B) {
+	h := NewWithLogger(discardLogger{})
+	h.SetLabels("user")
+	e := &logrus.Entry{
+		Data:    logrus.Fields{"user": "u", "request": 42, "path": "/index"},
+		Time:    time.Now(),
+		Level:   logrus.InfoLevel,
+		Message: "benchmark",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Fire(e)
+	}
+}
@@ -0,0 +1,40 @@
+package stackrus
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/logging"
+)
+
+// AddMirror makes the hook also write every entry it sends to logID through
+// client, e.g. to copy entries to a central security project. Mirrors are
+// always written asynchronously, even when the hook is sync, and their
+// delivery errors go to the error handler, or else the previous OnError
+// function of client, so a failing mirror never affects Fire. Each mirror
+// adds the cost of buffering and uploading every entry once more, and
+// entries keep the trace names of the hook's project. Close flushes mirrors
+// but leaves their clients open.
+func (h *Hook) AddMirror(client *logging.Client, logID string) error {
+	if client == nil {
+		return errors.New("stackrus: nil mirror client")
+	}
+	_, remove := routeClientErrors(client, func(err error) bool {
+		return h.handleError(fmt.Errorf("mirror %s: %v", logID, err))
+	})
+	logger := client.Logger(logID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeRoutes = append(h.removeRoutes, remove)
+	mirrors := make([]EntryLogger, 0, len(h.mirrors)+1)
+	h.mirrors = append(append(mirrors, h.mirrors...), logger)
+	return nil
+}
+
+// mirror hands entry to each of mirrors.
+func mirror(mirrors []EntryLogger, entry logging.Entry) {
+	for _, m := range mirrors {
+		m.Log(entry)
+	}
+}
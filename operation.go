@@ -0,0 +1,80 @@
+package stackrus
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+// OperationFields names the logrus fields that are used to build an entry's
+// Operation, which groups related entries in the Logs Explorer.
+type OperationFields struct {
+	ID       string
+	Producer string
+	First    string
+	Last     string
+}
+
+// DefaultOperationFields are the field names recognized by a new hook and
+// produced by WithOperation.
+var DefaultOperationFields = OperationFields{
+	ID:       "operationID",
+	Producer: "operationProducer",
+	First:    "operationFirst",
+	Last:     "operationLast",
+}
+
+// WithOperation returns fields that group an entry into the given operation.
+// The fields use the names in DefaultOperationFields, e.g.
+//
+//	log.WithFields(stackrus.WithOperation("job-42", "importer", true, false)).Info("starting")
+func WithOperation(id, producer string, first, last bool) logrus.Fields {
+	return logrus.Fields{
+		DefaultOperationFields.ID:       id,
+		DefaultOperationFields.Producer: producer,
+		DefaultOperationFields.First:    first,
+		DefaultOperationFields.Last:     last,
+	}
+}
+
+// SetOperationFields changes the field names used to build an entry's
+// Operation. Consumed fields are removed from the payload.
+func (h *Hook) SetOperationFields(fields OperationFields) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.operationFields = fields
+}
+
+// extractOperation builds an Operation from data, removing the fields it
+// consumes. It returns nil if the entry has no operation ID.
+func (b *entryBuilder) extractOperation(data map[string]interface{}) *logpb.LogEntryOperation {
+	f := b.operationFields
+	id, ok := popField(data, f.ID)
+	if !ok {
+		return nil
+	}
+	op := &logpb.LogEntryOperation{Id: id}
+	op.Producer, _ = popField(data, f.Producer)
+	if v, ok := parseBool(data[f.First]); ok {
+		op.First = v
+		delete(data, f.First)
+	}
+	if v, ok := parseBool(data[f.Last]); ok {
+		op.Last = v
+		delete(data, f.Last)
+	}
+	return op
+}
+
+func parseBool(v interface{}) (bool, bool) {
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case string:
+		b, err := strconv.ParseBool(t)
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,143 @@
+package stackrus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// Option configures a Hook created by NewHook.
+type Option func(*Hook)
+
+// WithSync makes the hook relay logs to the Stackdriver API synchronously.
+func WithSync() Option {
+	return func(h *Hook) {
+		h.sync = true
+	}
+}
+
+// WithSharedClient marks the client as shared with other code, so Close only
+// flushes the hook's logger instead of closing the client.
+func WithSharedClient() Option {
+	return func(h *Hook) {
+		h.ownsClient = false
+	}
+}
+
+// WithLoggerOptions passes opts through to the logging client when the
+// hook's logger is created. Hooks without a client, such as those returned by
+// NewWithLogger, ignore them.
+func WithLoggerOptions(opts ...logging.LoggerOption) Option {
+	return func(h *Hook) {
+		h.loggerOpts = append(h.loggerOpts, opts...)
+	}
+}
+
+// WithLevels is the option form of SetLevels.
+func WithLevels(levels ...logrus.Level) Option {
+	return func(h *Hook) {
+		h.SetLevels(levels...)
+	}
+}
+
+// WithDefaultLabels is the option form of SetDefaultLabels.
+func WithDefaultLabels(labels map[string]string) Option {
+	return func(h *Hook) {
+		h.SetDefaultLabels(labels)
+	}
+}
+
+// WithLabelKeys is the option form of SetLabels.
+func WithLabelKeys(keys ...string) Option {
+	return func(h *Hook) {
+		h.SetLabels(keys...)
+	}
+}
+
+// WithSeverityMapper is the option form of SetSeverityMapper.
+func WithSeverityMapper(mapper func(logrus.Level) logging.Severity) Option {
+	return func(h *Hook) {
+		h.SetSeverityMapper(mapper)
+	}
+}
+
+// WithCommonLabels passes labels through to the logger as
+// logging.CommonLabels. Unlike SetDefaultLabels, which copies labels into
+// every entry in Fire, common labels are sent once per write request and
+// merged into the entries by Stackdriver, so they don't get the label prefix
+// and labels on the entry win on conflict.
+func WithCommonLabels(labels map[string]string) Option {
+	return WithLoggerOptions(logging.CommonLabels(labels))
+}
+
+// WithLifecycleEvents enables SetEmitLifecycleEvents and logs
+// "stackrus hook initialized" once the hook is created.
+func WithLifecycleEvents() Option {
+	return func(h *Hook) {
+		h.lifecycleEvents = true
+	}
+}
+
+// WithBatchDelay sets the maximum time entries are buffered before being
+// sent (logging.DelayThreshold). Defaults to one second; high-throughput
+// services can raise it to a few seconds to send fewer, larger requests at
+// the cost of losing more entries on a crash. d must be positive.
+func WithBatchDelay(d time.Duration) Option {
+	return batchOption("WithBatchDelay", d > 0, d, logging.DelayThreshold(d))
+}
+
+// WithBatchCount sets the number of buffered entries that triggers a send
+// (logging.EntryCountThreshold). Defaults to 1000, which suits most
+// high-throughput services. n must be positive.
+func WithBatchCount(n int) Option {
+	return batchOption("WithBatchCount", n > 0, n, logging.EntryCountThreshold(n))
+}
+
+// WithBatchByteLimit sets the total size in bytes of buffered entries above
+// which new entries are dropped and reported as errors
+// (logging.BufferedByteLimit). Defaults to 1 GiB; lower it to bound memory
+// use when the API is unreachable. n must be positive.
+func WithBatchByteLimit(n int) Option {
+	return batchOption("WithBatchByteLimit", n > 0, n, logging.BufferedByteLimit(n))
+}
+
+// batchOption returns an option passing opt through to the logger, or
+// recording an error if value isn't valid.
+func batchOption(name string, valid bool, value interface{}, opt logging.LoggerOption) Option {
+	return func(h *Hook) {
+		if !valid {
+			if h.optErr == nil {
+				h.optErr = fmt.Errorf("%s value must be positive, got %v", name, value)
+			}
+			return
+		}
+		h.loggerOpts = append(h.loggerOpts, opt)
+	}
+}
+
+// WithResource sets the monitored resource of every entry written by the
+// logger (logging.CommonResource), e.g. "k8s_container" with its labels. It
+// is the logger-wide counterpart of SetMonitoredResource, which takes
+// precedence. resourceType must not be empty.
+func WithResource(resourceType string, labels map[string]string) Option {
+	return func(h *Hook) {
+		if resourceType == "" {
+			if h.optErr == nil {
+				h.optErr = errors.New("WithResource resource type must not be empty")
+			}
+			return
+		}
+		ls := make(map[string]string, len(labels))
+		for k, v := range labels {
+			ls[k] = v
+		}
+		h.loggerOpts = append(h.loggerOpts, logging.CommonResource(&mrpb.MonitoredResource{
+			Type:   resourceType,
+			Labels: ls,
+		}))
+	}
+}
@@ -0,0 +1,47 @@
+package stackrus
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+func TestWithCommonLabels(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "checkout"}
+	h := NewHook(&logging.Client{}, "log", WithCommonLabels(labels))
+	l, ok := h.logger.(*logging.Logger)
+	if !ok {
+		t.Fatalf("logger is %T, want *logging.Logger", h.logger)
+	}
+	// The logger doesn't expose its options, so read them from its fields.
+	common := reflect.ValueOf(l).Elem().FieldByName("commonLabels")
+	if !common.IsValid() {
+		t.Skip("logging.Logger has no commonLabels field")
+	}
+	if common.Len() != len(labels) {
+		t.Errorf("logger has %d common labels, want %d", common.Len(), len(labels))
+	}
+	for k, v := range labels {
+		if got := common.MapIndex(reflect.ValueOf(k)); !got.IsValid() || got.String() != v {
+			t.Errorf("common label %s = %v, want %q", k, got, v)
+		}
+	}
+}
+
+func TestNewWithLoggerReportsIgnoredOptions(t *testing.T) {
+	var reported []error
+	handler := func(h *Hook) {
+		h.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	}
+	NewWithLogger(&fakeLogger{}, handler, WithCommonLabels(map[string]string{"env": "prod"}))
+	if len(reported) != 1 {
+		t.Errorf("got %d reported errors for a logger option, want 1: %v", len(reported), reported)
+	}
+
+	reported = nil
+	NewWithLogger(&fakeLogger{}, handler, WithBatchCount(0))
+	if len(reported) != 1 {
+		t.Errorf("got %d reported errors for an invalid option, want 1: %v", len(reported), reported)
+	}
+}
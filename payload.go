@@ -0,0 +1,357 @@
+package stackrus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetPayloadBuilder sets a function whose result is used as the payload of
+// every entry instead of the map the hook builds from the message and
+// fields. A string result is sent as a textPayload and anything else as a
+// jsonPayload. Fields promoted to labels are still removed and sent as
+// labels; a builder that wants to handle them itself should not configure
+// any label keys.
+func (h *Hook) SetPayloadBuilder(builder func(*logrus.Entry) interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.payloadBuilder = builder
+}
+
+// SetIncludeSeverityInPayload adds the lowercase logrus level name, e.g.
+// "warning", to the payload of every entry under the severity payload key.
+// The entry's Stackdriver severity is unaffected.
+func (h *Hook) SetIncludeSeverityInPayload(include bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.severityInPayload = include
+}
+
+// SetSeverityPayloadKey sets the payload key used by
+// SetIncludeSeverityInPayload. Defaults to "severity".
+func (h *Hook) SetSeverityPayloadKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.severityPayloadKey = key
+}
+
+// SetPayloadNamespace nests the entry's fields under key in the payload,
+// e.g. payload["context"]["animal"], instead of placing them at the top
+// level. The message, severity and error fields, and the fields used by
+// Error Reporting, stay at the top level. A non-empty key selects
+// LayoutNested and an empty key, the default, LayoutFlat.
+func (h *Hook) SetPayloadNamespace(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.payloadNamespace = key
+}
+
+// SetPayloadFields restricts the payload to the message and the given
+// fields, dropping all others, e.g. to keep unvetted fields out of the logs.
+// It applies after redaction, so listed fields that are also redacted are
+// sent redacted, and after label promotion: fields moved to labels are sent
+// as labels whether listed or not, while fields copied to labels with
+// SetDuplicatedLabelKeys are only kept in the payload if listed. The error
+// field must be listed to be kept. Calling it without keys removes the
+// restriction.
+func (h *Hook) SetPayloadFields(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(keys) == 0 {
+		h.payloadFields = nil
+		return
+	}
+	h.payloadFields = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		h.payloadFields[k] = true
+	}
+}
+
+// SetFieldEncoder sets a function called for each payload field, except the
+// error field, e.g. to encode protobuf messages as their JSON form. If it
+// returns true, its result is used as the field's value as is, without
+// flattening or time normalization; otherwise the field is handled as usual.
+// It is not called for fields promoted to labels.
+func (h *Hook) SetFieldEncoder(encoder func(key string, value interface{}) (interface{}, bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fieldEncoder = encoder
+}
+
+// encodeField runs the field encoder, if any, on a payload field.
+func (b *entryBuilder) encodeField(k string, v interface{}) (interface{}, bool) {
+	if b.fieldEncoder == nil {
+		return nil, false
+	}
+	return b.fieldEncoder(k, v)
+}
+
+// SetLargeFieldHandler sets a handler for payload fields whose JSON encoding
+// exceeds threshold bytes, e.g. to upload full HTTP bodies to Cloud Storage
+// and log their URL instead. The handler's result replaces the field. With a
+// nil handler, large fields are replaced by their string form truncated to
+// threshold bytes and ending with "...". A threshold <= 0, the default,
+// disables the check.
+func (h *Hook) SetLargeFieldHandler(threshold int, handler func(key string, value interface{}) (replacement interface{})) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.largeFieldThreshold = threshold
+	h.largeFieldHandler = handler
+}
+
+// largeField returns the replacement of a payload field over the large field
+// threshold, and false if the field isn't large.
+func (b *entryBuilder) largeField(k string, v interface{}) (interface{}, bool) {
+	if b.largeFieldThreshold <= 0 || jsonSize(v) <= b.largeFieldThreshold {
+		return nil, false
+	}
+	if b.largeFieldHandler != nil {
+		return b.largeFieldHandler(k, v), true
+	}
+	s, ok := v.(string)
+	if !ok {
+		enc, err := json.Marshal(v)
+		if err != nil {
+			s = fmt.Sprintf("%v", v)
+		} else {
+			s = string(enc)
+		}
+	}
+	return truncate(s, b.largeFieldThreshold), true
+}
+
+// SetOmitEmptyMessage drops the message key from the payload of entries
+// logged with an empty message, unless the payload would be left empty.
+func (h *Hook) SetOmitEmptyMessage(omit bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.omitEmptyMessage = omit
+}
+
+// SetOmitEmpty makes the hook skip labels whose value is the empty string
+// and payload fields whose value is nil. Zero values such as 0 and false are
+// kept.
+func (h *Hook) SetOmitEmpty(omit bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.omitEmpty = omit
+}
+
+// PayloadLayout selects where entry fields are placed in the payload.
+type PayloadLayout int
+
+const (
+	// LayoutFlat places fields at the top level of the payload, alongside
+	// the message.
+	LayoutFlat PayloadLayout = iota
+	// LayoutNested places fields under the payload namespace key, while the
+	// message stays at the top level.
+	LayoutNested
+)
+
+// DefaultPayloadNamespace is the key fields are nested under with
+// LayoutNested if SetPayloadNamespace wasn't used.
+const DefaultPayloadNamespace = "fields"
+
+// SetPayloadLayout sets where entry fields are placed in the payload.
+// Defaults to LayoutFlat. LayoutNested uses the key set by
+// SetPayloadNamespace, or DefaultPayloadNamespace; LayoutFlat clears it.
+func (h *Hook) SetPayloadLayout(layout PayloadLayout) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch layout {
+	case LayoutFlat:
+		h.payloadNamespace = ""
+	case LayoutNested:
+		if h.payloadNamespace == "" {
+			h.payloadNamespace = DefaultPayloadNamespace
+		}
+	}
+}
+
+// buildPayload builds the payload of e from its message and the fields in
+// data that weren't consumed elsewhere.
+func (b *entryBuilder) buildPayload(e *logrus.Entry, data map[string]interface{}) interface{} {
+	payload := make(map[string]interface{}, len(data)+1)
+	payload[b.messageKey] = e.Message
+	if b.severityInPayload {
+		payload[b.severityPayloadKey] = e.Level.String()
+	}
+
+	fields := payload
+	if b.payloadNamespace != "" {
+		fields = make(map[string]interface{}, len(data))
+	}
+	for k, v := range data {
+		if v == nil && b.omitEmpty || b.payloadFields != nil && !b.payloadFields[k] {
+			continue
+		}
+		if k == b.messageKey {
+			if _, taken := data[b.messageFieldKey]; b.messageFieldKey == "" || taken {
+				b.h.messageKeyOnce.Do(func() {
+					b.report(fmt.Errorf("field %q collides with the message key and was dropped", k))
+				})
+			} else {
+				fields[b.messageFieldKey] = b.payloadValue(v)
+			}
+		} else if k == b.errorKey {
+			payload[k] = fmt.Sprintf("%v", v)
+			if stack, ok := errorStackTrace(v); ok {
+				payload[stackTraceKey] = stack
+			}
+		} else if enc, ok := b.encodeField(k, v); ok {
+			if large, ok := b.largeField(k, enc); ok {
+				enc = large
+			}
+			fields[k] = enc
+		} else if large, ok := b.largeField(k, v); ok {
+			fields[k] = large
+		} else if b.flatten {
+			b.flattenInto(fields, k, v, 0)
+		} else {
+			fields[k] = b.payloadValue(v)
+		}
+	}
+	if b.payloadNamespace != "" && len(fields) > 0 {
+		payload[b.payloadNamespace] = fields
+	}
+	b.addErrorReport(e, payload)
+	if b.textPayload && len(payload) == 1 {
+		return e.Message
+	}
+	if b.omitEmptyMessage && e.Message == "" && len(payload) > 1 {
+		delete(payload, b.messageKey)
+	}
+	return payload
+}
+
+// SetNormalizeTimeFields makes time.Time payload values be sent as RFC 3339
+// strings and time.Duration payload values as a number of milliseconds, so
+// that they can be queried in the Logs Explorer.
+func (h *Hook) SetNormalizeTimeFields(normalize bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.normalizeTimes = normalize
+}
+
+// payloadValue converts a field value before it is stored in the payload.
+func (b *entryBuilder) payloadValue(v interface{}) interface{} {
+	if !b.normalizeTimes {
+		return v
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case time.Duration:
+		return float64(t) / float64(time.Millisecond)
+	default:
+		return v
+	}
+}
+
+// truncatedKey marks payloads from which fields were dropped to fit the
+// maximum payload size.
+const truncatedKey = "_truncated"
+
+// SetMaxPayloadBytes sets a limit on the JSON-encoded size of payloads,
+// which Stackdriver rejects above roughly 256KB. The largest fields of an
+// oversized payload are dropped until it fits and truncatedKey is set to
+// true. If the payload still doesn't fit, the message is truncated, and only
+// if that isn't enough either is the entry dropped and reported to the error
+// handler. A limit <= 0, the default, disables the check.
+func (h *Hook) SetMaxPayloadBytes(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxPayloadBytes = n
+}
+
+// limitPayload enforces the maximum payload size.
+func (b *entryBuilder) limitPayload(payload interface{}) (interface{}, error) {
+	if b.maxPayloadBytes <= 0 {
+		return payload, nil
+	}
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		if s, ok := payload.(string); ok {
+			if t, ok := truncateJSON(s, b.maxPayloadBytes); ok {
+				return t, nil
+			}
+		}
+		if size := jsonSize(payload); size > b.maxPayloadBytes {
+			return nil, fmt.Errorf("payload of %d bytes exceeds the limit of %d bytes, entry dropped", size, b.maxPayloadBytes)
+		}
+		return payload, nil
+	}
+
+	type field struct {
+		key  string
+		size int
+	}
+	total := 2 // braces
+	fields := make([]field, 0, len(m))
+	for k, v := range m {
+		size := jsonSize(k) + jsonSize(v) + 2 // colon and comma
+		total += size
+		if k != b.messageKey {
+			fields = append(fields, field{k, size})
+		}
+	}
+	if total <= b.maxPayloadBytes {
+		return m, nil
+	}
+
+	// The payload may come from the payload builder, which can keep or
+	// reuse it, so trim a copy.
+	trimmed := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		trimmed[k] = v
+	}
+	m = trimmed
+	sort.Slice(fields, func(i, j int) bool { return fields[i].size > fields[j].size })
+	total += jsonSize(truncatedKey) + jsonSize(true) + 2
+	for _, f := range fields {
+		if total <= b.maxPayloadBytes {
+			break
+		}
+		delete(m, f.key)
+		total -= f.size
+	}
+	if msg, ok := m[b.messageKey].(string); ok && total > b.maxPayloadBytes {
+		size := jsonSize(msg)
+		if t, ok := truncateJSON(msg, size-(total-b.maxPayloadBytes)); ok {
+			m[b.messageKey] = t
+			total -= size - jsonSize(t)
+		}
+	}
+	if total > b.maxPayloadBytes {
+		return nil, fmt.Errorf("payload exceeds the limit of %d bytes even without fields, entry dropped", b.maxPayloadBytes)
+	}
+	m[truncatedKey] = true
+	return m, nil
+}
+
+// truncateJSON truncates s so that its JSON encoding takes at most n bytes,
+// reporting whether it could.
+func truncateJSON(s string, n int) (string, bool) {
+	for limit := n; limit > 0; {
+		t := truncate(s, limit)
+		size := jsonSize(t)
+		if size <= n {
+			return t, true
+		}
+		limit -= size - n
+	}
+	return "", false
+}
+
+// jsonSize estimates the JSON-encoded size of v.
+func jsonSize(v interface{}) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return len(fmt.Sprintf("%v", v))
+	}
+	return len(b)
+}
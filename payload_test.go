@@ -0,0 +1,65 @@
+package stackrus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLimitPayloadCopiesBuilderPayload(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	built := map[string]interface{}{"message": "big", "blob": strings.Repeat("x", 1000)}
+	h.SetPayloadBuilder(func(*logrus.Entry) interface{} { return built })
+	h.SetMaxPayloadBytes(100)
+
+	payload := fire(t, h, l, logrus.InfoLevel, "big", nil)
+	if _, ok := payload["blob"]; ok || payload[truncatedKey] != true {
+		t.Errorf("payload = %v, want blob dropped and %s set", payload, truncatedKey)
+	}
+	if _, ok := built["blob"]; !ok || len(built) != 2 {
+		t.Errorf("payload builder's map was modified: %v", built)
+	}
+}
+
+func TestLimitPayloadTruncatesMessage(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetMaxPayloadBytes(100)
+
+	payload := fire(t, h, l, logrus.InfoLevel, strings.Repeat("x", 1000), logrus.Fields{"blob": strings.Repeat("y", 1000)})
+	msg, _ := payload["message"].(string)
+	if !strings.HasSuffix(msg, truncatedMarker) || payload[truncatedKey] != true {
+		t.Errorf("payload = %v, want a truncated message and %s set", payload, truncatedKey)
+	}
+	if _, ok := payload["blob"]; ok {
+		t.Errorf("payload = %v, want blob dropped", payload)
+	}
+	if size := jsonSize(payload); size > 100 {
+		t.Errorf("payload is %d bytes, want at most 100", size)
+	}
+}
+
+func TestMessageFieldCollision(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	var reported []error
+	h.SetErrorHandler(func(err error) { reported = append(reported, err) })
+
+	payload := fire(t, h, l, logrus.InfoLevel, "msg", logrus.Fields{"message": "field"})
+	if payload["message"] != "msg" || payload["message_field"] != "field" {
+		t.Errorf("payload = %v, want the field moved to message_field", payload)
+	}
+	if len(reported) != 0 {
+		t.Errorf("moved field reported: %v", reported)
+	}
+
+	payload = fire(t, h, l, logrus.InfoLevel, "msg", logrus.Fields{"message": "field", "message_field": "taken"})
+	if payload["message"] != "msg" || payload["message_field"] != "taken" {
+		t.Errorf("payload = %v, want the colliding field dropped", payload)
+	}
+	if len(reported) != 1 {
+		t.Errorf("got %d reported errors, want 1: %v", len(reported), reported)
+	}
+}
@@ -0,0 +1,39 @@
+package stackrus
+
+import (
+	"context"
+
+	"cloud.google.com/go/logging"
+)
+
+// DefaultPingLogID is the log Ping writes to unless SetPingLogID is used.
+const DefaultPingLogID = "stackrus-ping"
+
+// SetPingLogID sets the log ID Ping writes its diagnostic entries to.
+// Hooks without a client always ping their own logger.
+func (h *Hook) SetPingLogID(logID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pingLogID = logID
+}
+
+// Ping synchronously writes a Debug entry labeled stackrus_ping=true to the
+// ping log and returns any error, e.g. to fail a readiness probe when
+// credentials are broken or the API is unreachable. The entry bypasses the
+// hook's levels, sampling and payload processing.
+func (h *Hook) Ping(ctx context.Context) error {
+	b := h.builder()
+	logID := b.pingLogID
+	if logID == "" {
+		logID = DefaultPingLogID
+	}
+	logger := b.loggerFor(logID)
+	ts := b.clock()
+
+	return logger.LogSync(ctx, logging.Entry{
+		Timestamp: ts,
+		Severity:  logging.Debug,
+		Labels:    map[string]string{"stackrus_ping": "true"},
+		Payload:   map[string]interface{}{defaultMessageKey: "stackrus ping"},
+	})
+}
@@ -0,0 +1,34 @@
+package stackrus
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RecoverAndLog recovers a panic, synchronously sends a PanicLevel entry
+// holding the recovered value and the goroutine's stack, and panics again
+// with the same value. It must be deferred directly:
+//
+//	defer hook.RecoverAndLog()
+func (h *Hook) RecoverAndLog() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := h.fire(&logrus.Entry{
+		Data: logrus.Fields{
+			"panic":       fmt.Sprint(r),
+			stackTraceKey: string(debug.Stack()),
+		},
+		Time:    time.Now(),
+		Level:   logrus.PanicLevel,
+		Message: fmt.Sprintf("panic: %v", r),
+	}, true)
+	if err != nil {
+		h.reportError(err)
+	}
+	panic(r)
+}
@@ -0,0 +1,38 @@
+package stackrus
+
+// SetRedactedFields sets field keys that are never sent to Stackdriver.
+// Redaction happens before any other field processing, so a redacted field
+// is neither promoted to a label nor used to populate the entry, even if it
+// is also passed to SetLabels.
+func (h *Hook) SetRedactedFields(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.redacted = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		h.redacted[k] = true
+	}
+}
+
+// SetRedactionPlaceholder makes redacted fields be kept with the placeholder
+// as their value, e.g. "[REDACTED]", instead of being dropped. An empty
+// placeholder, the default, drops them.
+func (h *Hook) SetRedactionPlaceholder(placeholder string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.redactionPlaceholder = placeholder
+}
+
+// redact removes redacted fields from data or replaces their values with the
+// redaction placeholder.
+func (b *entryBuilder) redact(data map[string]interface{}) {
+	for k := range b.redacted {
+		if _, ok := data[k]; !ok {
+			continue
+		}
+		if b.redactionPlaceholder == "" {
+			delete(data, k)
+		} else {
+			data[k] = b.redactionPlaceholder
+		}
+	}
+}
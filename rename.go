@@ -0,0 +1,46 @@
+package stackrus
+
+import "sort"
+
+// SetFieldKeyMap renames fields by mapping source keys to the keys used in
+// Stackdriver, e.g. {"uid": "user_id"}. Renaming happens after redaction and
+// before any other field processing, so other configuration such as
+// SetLabels refers to the renamed keys. If several fields end up with the
+// same key, a field that already had that key wins; otherwise the field whose
+// source key sorts first wins and the others are dropped.
+func (h *Hook) SetFieldKeyMap(m map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fieldKeyMap = make(map[string]string, len(m))
+	for k, v := range m {
+		h.fieldKeyMap[k] = v
+	}
+}
+
+// renameFields applies the field key map to data.
+func (b *entryBuilder) renameFields(data map[string]interface{}) {
+	if len(b.fieldKeyMap) == 0 {
+		return
+	}
+	var renamed []string
+	for k := range data {
+		if _, ok := b.fieldKeyMap[k]; ok {
+			renamed = append(renamed, k)
+		}
+	}
+	if len(renamed) == 0 {
+		return
+	}
+	sort.Strings(renamed)
+	values := make([]interface{}, len(renamed))
+	for i, k := range renamed {
+		values[i] = data[k]
+		delete(data, k)
+	}
+	for i, k := range renamed {
+		target := b.fieldKeyMap[k]
+		if _, ok := data[target]; !ok {
+			data[target] = values[i]
+		}
+	}
+}
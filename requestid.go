@@ -0,0 +1,55 @@
+package stackrus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"cloud.google.com/go/logging"
+)
+
+// SetRequestIDField sets the name of a field holding a request or
+// correlation ID. The ID is written as a label under the field's name and
+// removed from the payload. Unless disabled with SetRequestIDTrace, entries
+// without a trace get a synthetic one derived from the ID, so that all
+// entries of a request are grouped together in the Logs Explorer.
+func (h *Hook) SetRequestIDField(field string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requestIDField = field
+	if field != "" {
+		h.needProjectID()
+	}
+}
+
+// SetRequestIDTrace enables or disables the synthetic trace derived from the
+// request ID field. Enabled by default.
+func (h *Hook) SetRequestIDTrace(enabled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.noRequestIDTrace = !enabled
+}
+
+// applyRequestID moves the request ID field from data to labels, and derives
+// the entry's trace from it if it has none.
+func (b *entryBuilder) applyRequestID(entry *logging.Entry, labels map[string]string, data map[string]interface{}) {
+	if b.requestIDField == "" {
+		return
+	}
+	v, ok := data[b.requestIDField]
+	if !ok {
+		return
+	}
+	delete(data, b.requestIDField)
+	id := b.labelValue(v)
+	labels[b.labelKey(b.requestIDField)] = id
+	if b.noRequestIDTrace || entry.Trace != "" || id == "" {
+		return
+	}
+	entry.Trace = b.qualifyTrace(syntheticTraceID(id))
+}
+
+// syntheticTraceID returns a 32 hex character trace ID derived from id.
+func syntheticTraceID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
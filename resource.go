@@ -0,0 +1,167 @@
+package stackrus
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/compute/metadata"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+var (
+	detectOnce       sync.Once
+	detectedResource *mrpb.MonitoredResource
+	detectErr        error
+)
+
+// SetAutoDetectResource enables attaching a monitored resource detected from
+// the GCP environment (Cloud Run, GKE or GCE) to every entry. Detection
+// queries the metadata server once per process, when first enabled. If it
+// fails, e.g. when not running on GCP, the error is reported to the error
+// handler and the client's default resource is used. A resource set with
+// SetMonitoredResource takes precedence.
+func (h *Hook) SetAutoDetectResource(autoDetect bool) {
+	var err error
+	if autoDetect {
+		detectOnce.Do(func() {
+			detectedResource, detectErr = detectResource()
+		})
+		err = detectErr
+	}
+
+	h.mu.Lock()
+	h.autoDetectResource = autoDetect && err == nil
+	h.mu.Unlock()
+
+	if err != nil {
+		h.reportError(fmt.Errorf("detecting monitored resource: %v", err))
+	}
+}
+
+// SetResourceLabels sets labels merged into the monitored resource of every
+// entry, e.g. a zone. They override the labels of a resource set with
+// SetMonitoredResource, but not those of an auto-detected resource. Without
+// either, entries get a "global" resource carrying just these labels.
+func (h *Hook) SetResourceLabels(labels map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resourceLabels = make(map[string]string, len(labels))
+	for k, v := range labels {
+		h.resourceLabels[k] = v
+	}
+}
+
+// entryResource returns the monitored resource to attach to entries, or nil
+// to use the client's default.
+func (b *entryBuilder) entryResource() *mrpb.MonitoredResource {
+	switch {
+	case b.resource != nil:
+		return mergeResourceLabels(b.resource, b.resourceLabels, true)
+	case b.autoDetectResource:
+		return mergeResourceLabels(detectedResource, b.resourceLabels, false)
+	case len(b.resourceLabels) > 0:
+		return mergeResourceLabels(&mrpb.MonitoredResource{Type: "global"}, b.resourceLabels, true)
+	}
+	return nil
+}
+
+// mergeResourceLabels returns a copy of r with labels merged into its own,
+// or r itself if there are none. override says whether labels win over r's
+// labels with the same key.
+func mergeResourceLabels(r *mrpb.MonitoredResource, labels map[string]string, override bool) *mrpb.MonitoredResource {
+	if len(labels) == 0 {
+		return r
+	}
+	merged := make(map[string]string, len(r.Labels)+len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range r.Labels {
+		if _, ok := merged[k]; !ok || !override {
+			merged[k] = v
+		}
+	}
+	return &mrpb.MonitoredResource{Type: r.Type, Labels: merged}
+}
+
+func detectResource() (*mrpb.MonitoredResource, error) {
+	if !metadata.OnGCE() {
+		return nil, errors.New("not running on GCP")
+	}
+	projectID, err := metadata.ProjectID()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case os.Getenv("K_SERVICE") != "":
+		region, err := metadata.Get("instance/region")
+		if err != nil {
+			return nil, err
+		}
+		return &mrpb.MonitoredResource{
+			Type: "cloud_run_revision",
+			Labels: map[string]string{
+				"project_id":         projectID,
+				"location":           path.Base(region),
+				"service_name":       os.Getenv("K_SERVICE"),
+				"revision_name":      os.Getenv("K_REVISION"),
+				"configuration_name": os.Getenv("K_CONFIGURATION"),
+			},
+		}, nil
+	case os.Getenv("KUBERNETES_SERVICE_HOST") != "":
+		cluster, err := metadata.InstanceAttributeValue("cluster-name")
+		if err != nil {
+			return nil, err
+		}
+		location, err := metadata.InstanceAttributeValue("cluster-location")
+		if err != nil {
+			return nil, err
+		}
+		return &mrpb.MonitoredResource{
+			Type: "k8s_container",
+			Labels: map[string]string{
+				"project_id":     projectID,
+				"location":       location,
+				"cluster_name":   cluster,
+				"namespace_name": podNamespace(),
+				"pod_name":       os.Getenv("HOSTNAME"),
+				"container_name": os.Getenv("CONTAINER_NAME"),
+			},
+		}, nil
+	default:
+		instanceID, err := metadata.InstanceID()
+		if err != nil {
+			return nil, err
+		}
+		zone, err := metadata.Zone()
+		if err != nil {
+			return nil, err
+		}
+		return &mrpb.MonitoredResource{
+			Type: "gce_instance",
+			Labels: map[string]string{
+				"project_id":  projectID,
+				"instance_id": instanceID,
+				"zone":        zone,
+			},
+		}, nil
+	}
+}
+
+// podNamespace returns the Kubernetes namespace of the current pod, preferring
+// the NAMESPACE environment variable (typically set via the downward API).
+func podNamespace() string {
+	if ns := os.Getenv("NAMESPACE"); ns != "" {
+		return ns
+	}
+	b, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,72 @@
+package stackrus
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetSampleRate makes the hook send only a fraction rate, between 0 and 1,
+// of the entries at level. Entries are sampled at random; a rate of 1 or
+// more sends everything and a rate of 0 or less sends nothing.
+func (h *Hook) SetSampleRate(level logrus.Level, rate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rates := make(map[logrus.Level]float64, len(h.sampleRates)+1)
+	for l, r := range h.sampleRates {
+		rates[l] = r
+	}
+	rates[level] = rate
+	h.sampleRates = rates
+}
+
+// SetSampler replaces the rate based sampling set up by SetSampleRate with a
+// custom decision function, which returns true for entries to send.
+func (h *Hook) SetSampler(sampler func(*logrus.Entry) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sampler = sampler
+}
+
+// SetConsistentSampling makes the hook send a fraction rate, between 0 and
+// 1, of the distinct values of field, e.g. a trace ID, so that all entries
+// with the same value are either sent or dropped together. The decision is
+// a hash of the value, so it is also consistent across processes. Entries
+// without the field are sampled as usual. An empty field disables it.
+func (h *Hook) SetConsistentSampling(field string, rate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.consistentSampleField = field
+	h.consistentSampleRate = rate
+}
+
+// sample reports whether e should be sent.
+func (b *entryBuilder) sample(e *logrus.Entry) bool {
+	if v, ok := e.Data[b.consistentSampleField]; ok && b.consistentSampleField != "" {
+		return sampleValue(v, b.consistentSampleRate)
+	}
+	if b.sampler != nil {
+		return b.sampler(e)
+	}
+	rate, ok := b.sampleRates[e.Level]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
+
+// sampleValue reports whether the hash of v falls within rate.
+func sampleValue(v interface{}, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	f := fnv.New64a()
+	fmt.Fprint(f, v)
+	return float64(f.Sum64()) < rate*math.MaxUint64
+}
@@ -0,0 +1,98 @@
+package stackrus
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds how long the shutdown handler waits for
+// buffered entries to be delivered.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// SetShutdownTimeout sets how long the handler installed by
+// InstallShutdownHandler waits for the hook to flush and close. Defaults to
+// DefaultShutdownTimeout.
+func (h *Hook) SetShutdownTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shutdownTimeout = timeout
+}
+
+// SetShutdownReraise sets whether the handler installed by
+// InstallShutdownHandler re-raises the signal once the hook is closed, which
+// it does by default. Applications that handle the signals themselves, e.g.
+// to drain HTTP servers before exiting, should disable it so the re-raised
+// signal doesn't reach their handlers a second time.
+func (h *Hook) SetShutdownReraise(reraise bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.noShutdownReraise = !reraise
+}
+
+// InstallShutdownHandler flushes and closes the hook when one of signals,
+// by default SIGINT and SIGTERM, is received, so that buffered entries aren't
+// lost when e.g. a Kubernetes pod is terminated. The handler is additive:
+// other handlers registered with signal.Notify still receive the signal.
+// Registering a handler disables Go's default action for the signals, so once
+// the hook is closed the handler uninstalls itself and, unless disabled with
+// SetShutdownReraise, re-raises the signal; a process without other handlers
+// then terminates as it normally would. Since Close is idempotent, the
+// application may still close the hook itself. The returned function
+// uninstalls the handler.
+func (h *Hook) InstallShutdownHandler(signals ...os.Signal) (uninstall func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			if h.shutdown() {
+				if p, err := os.FindProcess(os.Getpid()); err == nil {
+					p.Signal(sig)
+				}
+			}
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// shutdown closes the hook, giving up after the shutdown timeout, and
+// reports whether the signal should be re-raised.
+func (h *Hook) shutdown() (reraise bool) {
+	h.mu.RLock()
+	timeout, reraise := h.shutdownTimeout, !h.noShutdownReraise
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- h.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			h.reportError(err)
+		}
+	case <-ctx.Done():
+		h.reportError(ctx.Err())
+	}
+	return reraise
+}
@@ -0,0 +1,32 @@
+package stackrus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCloseIsIdempotent(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetEmitLifecycleEvents(true)
+	for i := 0; i < 2; i++ {
+		if err := h.Close(); err != nil {
+			t.Fatalf("Close #%d: %v", i+1, err)
+		}
+	}
+	if len(l.entries) != 1 {
+		t.Errorf("got %d entries, want a single shutdown event", len(l.entries))
+	}
+
+	if err := h.Fire(&logrus.Entry{Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel}); err != nil {
+		t.Fatalf("Fire after Close: %v", err)
+	}
+	if len(l.entries) != 1 {
+		t.Error("entry fired after Close was sent")
+	}
+	if got := h.Stats().Dropped; got != 1 {
+		t.Errorf("Dropped = %d, want 1", got)
+	}
+}
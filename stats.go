@@ -0,0 +1,34 @@
+package stackrus
+
+import "sync/atomic"
+
+// HookStats are counts of entries processed by a hook.
+type HookStats struct {
+	// Sent is the number of entries handed to the logging client.
+	Sent uint64
+	// Failed is the number of errors reported by the logging client, and of
+	// synchronous writes that failed.
+	Failed uint64
+	// Dropped is the number of entries the hook discarded without sending.
+	Dropped uint64
+	// Sampled is the number of entries skipped by sampling.
+	Sampled uint64
+}
+
+type hookCounters struct {
+	sent, failed, dropped, sampled uint64
+
+	// enqueued counts async entries for SetFlushEveryN.
+	enqueued uint64
+}
+
+// Stats returns the hook's counters. It is cheap and safe to call
+// concurrently with Fire.
+func (h *Hook) Stats() HookStats {
+	return HookStats{
+		Sent:    atomic.LoadUint64(&h.counters.sent),
+		Failed:  atomic.LoadUint64(&h.counters.failed),
+		Dropped: atomic.LoadUint64(&h.counters.dropped),
+		Sampled: atomic.LoadUint64(&h.counters.sampled),
+	}
+}
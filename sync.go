@@ -0,0 +1,108 @@
+package stackrus
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SetSyncRetry makes synchronous writes that fail with a transient error
+// (Unavailable or DeadlineExceeded) be retried up to maxAttempts times in
+// total, waiting backoff before the first retry and doubling it after each.
+// Retries stop as soon as the sync context is done.
+func (h *Hook) SetSyncRetry(maxAttempts int, backoff time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.syncAttempts = maxAttempts
+	h.syncBackoff = backoff
+}
+
+// SetSyncLevels makes entries at the given levels be written synchronously,
+// even when the hook is asynchronous, e.g. to guarantee that errors are
+// delivered before a request returns. Entries at other levels follow the
+// hook's mode. The sync context, timeout and retries only apply to entries
+// written synchronously.
+func (h *Hook) SetSyncLevels(levels ...logrus.Level) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.syncLevels = make(map[logrus.Level]bool, len(levels))
+	for _, l := range levels {
+		h.syncLevels[l] = true
+	}
+}
+
+// sendsSync reports whether entries at level are written synchronously.
+func (b *entryBuilder) sendsSync(level logrus.Level) bool {
+	return b.sync || b.syncLevels[level]
+}
+
+// SetSyncTimeout sets a deadline for each synchronous write, derived from the
+// sync context, so that a slow Stackdriver call can't block the caller
+// indefinitely. Retries happen within the same deadline. A zero timeout, the
+// default, adds no deadline.
+func (h *Hook) SetSyncTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.syncTimeout = timeout
+}
+
+// syncSettings is the part of the hook's configuration used by synchronous
+// writes.
+type syncSettings struct {
+	ctx      context.Context
+	timeout  time.Duration
+	attempts int
+	backoff  time.Duration
+}
+
+// syncSettings returns the settings for synchronous writes.
+func (b *entryBuilder) syncSettings() syncSettings {
+	return syncSettings{
+		ctx:      b.syncCtx,
+		timeout:  b.syncTimeout,
+		attempts: b.syncAttempts,
+		backoff:  b.syncBackoff,
+	}
+}
+
+// logSync writes entry synchronously according to s.
+func (s syncSettings) logSync(logger EntryLogger, entry logging.Entry) error {
+	ctx := s.ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return logSyncRetry(ctx, logger, entry, s.attempts, s.backoff)
+}
+
+// logSyncRetry writes entry synchronously, retrying transient errors.
+func logSyncRetry(ctx context.Context, logger EntryLogger, entry logging.Entry, attempts int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := logger.LogSync(ctx, entry)
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
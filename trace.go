@@ -0,0 +1,372 @@
+package stackrus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	projectIDOnce     sync.Once
+	projectIDDetected = make(chan struct{})
+	detectedProjectID string
+)
+
+// SetProjectID sets the GCP project ID used to build fully qualified trace
+// resource names (projects/PROJECT_ID/traces/TRACE_ID). When unset, the
+// project ID is taken from the GOOGLE_CLOUD_PROJECT environment variable or,
+// on GCP, the metadata server. The metadata server is queried in the
+// background once a setting that needs the project ID, such as
+// SetTraceContextKey, is configured without one, or when an entry first
+// needs it; entries logged before it answers don't get a trace.
+func (h *Hook) SetProjectID(projectID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.projectID = projectID
+}
+
+// needProjectID starts detecting the project ID for a setting that needs it,
+// unless it is set. It must be called with h.mu held.
+func (h *Hook) needProjectID() {
+	if h.projectID == "" {
+		detectProjectID()
+	}
+}
+
+// ProjectID returns the project ID used for trace names, or the empty string
+// if it couldn't be determined. It waits for the project ID to be detected if
+// it wasn't set.
+func (h *Hook) ProjectID() string {
+	b := h.builder()
+	if b.projectID != "" {
+		return b.projectID
+	}
+	detectProjectID()
+	<-projectIDDetected
+	return detectedProjectID
+}
+
+// detectProjectID starts detecting the project ID, at most once per process.
+// The environment is checked right away, the metadata server in the
+// background.
+func detectProjectID() {
+	projectIDOnce.Do(func() {
+		if id := os.Getenv("GOOGLE_CLOUD_PROJECT"); id != "" {
+			detectedProjectID = id
+			close(projectIDDetected)
+			return
+		}
+		go func() {
+			defer close(projectIDDetected)
+			if metadata.OnGCE() {
+				detectedProjectID, _ = metadata.ProjectID()
+			}
+		}()
+	})
+}
+
+// resolvedProjectID returns the explicit or detected project ID without
+// waiting for detection, and whether it is final: false means detection is
+// still in progress. Detection is started if it wasn't yet.
+func (b *entryBuilder) resolvedProjectID() (string, bool) {
+	if b.projectID != "" {
+		return b.projectID, true
+	}
+	detectProjectID()
+	select {
+	case <-projectIDDetected:
+		return detectedProjectID, true
+	default:
+		return "", false
+	}
+}
+
+// qualifyTrace returns the fully qualified trace name for traceID. If the
+// project ID can't be determined, it returns the empty string and reports it
+// to the error handler once.
+func (b *entryBuilder) qualifyTrace(traceID string) string {
+	projectID, final := b.resolvedProjectID()
+	if projectID == "" {
+		if final {
+			b.h.noProjectIDOnce.Do(func() {
+				b.report(errors.New("project ID unknown, trace not attached; use SetProjectID"))
+			})
+		}
+		return ""
+	}
+	return traceName(projectID, traceID)
+}
+
+// SetTraceContextKey sets the context key under which a Cloud Trace ID is
+// stored. When an entry is logged with logrus.WithContext, the value stored
+// under this key is attached to the Stackdriver entry as its trace.
+func (h *Hook) SetTraceContextKey(key interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.traceContextKey = key
+	if key != nil {
+		h.needProjectID()
+	}
+}
+
+// traceFromContext returns the fully qualified trace name stored in ctx, or
+// the empty string if there is none.
+func (b *entryBuilder) traceFromContext(ctx context.Context) string {
+	if ctx == nil || b.traceContextKey == nil {
+		return ""
+	}
+	var traceID string
+	switch t := ctx.Value(b.traceContextKey).(type) {
+	case string:
+		traceID = t
+	case fmt.Stringer:
+		traceID = t.String()
+	}
+	if traceID == "" {
+		return ""
+	}
+	return b.qualifyTrace(traceID)
+}
+
+func traceName(projectID, traceID string) string {
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)
+}
+
+// SetSpanIDKey sets the name of the field whose value is used as the entry's
+// span ID. Defaults to "spanID". The field is removed from the payload.
+func (h *Hook) SetSpanIDKey(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.spanIDKey = key
+}
+
+// SetSpanIDContextKey sets the context key under which a span ID is stored.
+// It is only consulted when the span ID field is absent from the entry.
+func (h *Hook) SetSpanIDContextKey(key interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.spanIDContextKey = key
+}
+
+// extractSpanID removes the span ID field from data and returns its value,
+// falling back to the span ID stored in ctx.
+func (b *entryBuilder) extractSpanID(ctx context.Context, data map[string]interface{}) string {
+	if spanID, ok := popField(data, b.spanIDKey); ok {
+		return spanID
+	}
+	if ctx == nil || b.spanIDContextKey == nil {
+		return ""
+	}
+	switch t := ctx.Value(b.spanIDContextKey).(type) {
+	case string:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	}
+	return ""
+}
+
+// ParseCloudTraceContext parses an X-Cloud-Trace-Context header of the form
+// "TRACE_ID/SPAN_ID;o=OPTIONS". The span ID is returned in the hexadecimal
+// form expected by Stackdriver. ok is false if the header is malformed.
+func ParseCloudTraceContext(header string) (traceID, spanID string, sampled bool, ok bool) {
+	parts := strings.SplitN(header, ";", 2)
+	ids := strings.SplitN(parts[0], "/", 2)
+	traceID = ids[0]
+	if len(traceID) != 32 || !isHex(traceID) {
+		return "", "", false, false
+	}
+	if len(ids) == 2 && ids[1] != "" {
+		n, err := strconv.ParseUint(ids[1], 10, 64)
+		if err != nil {
+			return "", "", false, false
+		}
+		spanID = fmt.Sprintf("%016x", n)
+	}
+	if len(parts) == 2 {
+		sampled = parts[1] == "o=1"
+	}
+	return traceID, spanID, sampled, true
+}
+
+// ParseTraceparent parses a W3C traceparent value of the form
+// "VERSION-TRACE_ID-SPAN_ID-FLAGS". ok is false if the value doesn't conform
+// to the specification.
+func ParseTraceparent(value string) (traceID, spanID string, sampled bool, ok bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 {
+		return "", "", false, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" ||
+		len(traceID) != 32 || !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		len(spanID) != 16 || !isLowerHex(spanID) || spanID == strings.Repeat("0", 16) ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return "", "", false, false
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return traceID, spanID, f&1 == 1, true
+}
+
+func isLowerHex(s string) bool {
+	return isHex(s) && strings.ToLower(s) == s
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceFormat selects the formats accepted in the trace header field. Formats
+// can be combined, e.g. TraceFormatW3C | TraceFormatCloud.
+type TraceFormat int
+
+const (
+	// TraceFormatCloud is the X-Cloud-Trace-Context header format.
+	TraceFormatCloud TraceFormat = 1 << iota
+	// TraceFormatW3C is the W3C traceparent format used by OpenTelemetry.
+	TraceFormatW3C
+)
+
+// SetTraceFormat sets the formats accepted in the trace header field.
+// Defaults to TraceFormatCloud. When several formats are set, W3C is tried
+// first.
+func (h *Hook) SetTraceFormat(format TraceFormat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.traceFormat = format
+}
+
+// parseTraceHeader parses value in one of the hook's trace formats.
+func (b *entryBuilder) parseTraceHeader(value string) (traceID, spanID string, sampled bool, ok bool) {
+	if b.traceFormat&TraceFormatW3C != 0 {
+		if traceID, spanID, sampled, ok = ParseTraceparent(value); ok {
+			return traceID, spanID, sampled, true
+		}
+	}
+	if b.traceFormat&TraceFormatCloud != 0 {
+		return ParseCloudTraceContext(value)
+	}
+	return "", "", false, false
+}
+
+// SetTraceHeaderField sets the name of a field holding a trace header value
+// in one of the formats set by SetTraceFormat, which is parsed into the
+// entry's trace, span ID and sampling decision. The field is removed from the
+// payload if it parses; malformed values are left in the payload.
+func (h *Hook) SetTraceHeaderField(field string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.traceHeaderField = field
+	if field != "" {
+		h.needProjectID()
+	}
+}
+
+// applyTraceHeader sets the entry's trace fields from the trace header field
+// in data, removing the field if it parses.
+func (b *entryBuilder) applyTraceHeader(entry *logging.Entry, data map[string]interface{}) {
+	if b.traceHeaderField == "" {
+		return
+	}
+	header, ok := data[b.traceHeaderField].(string)
+	if !ok {
+		return
+	}
+	traceID, spanID, sampled, ok := b.parseTraceHeader(header)
+	if !ok {
+		return
+	}
+	trace := b.qualifyTrace(traceID)
+	if trace == "" {
+		return
+	}
+	delete(data, b.traceHeaderField)
+	entry.Trace = trace
+	if spanID != "" {
+		entry.SpanID = spanID
+	}
+	entry.TraceSampled = sampled
+}
+
+// Reserved field keys set by WithTrace. They match the special fields
+// recognized by Stackdriver's structured logging.
+const (
+	traceKey        = "logging.googleapis.com/trace"
+	spanIDKey       = "logging.googleapis.com/spanId"
+	traceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// WithTrace returns fields that attach the given trace to a single entry,
+// for callers that don't propagate traces through the context. The trace ID
+// is qualified with the hook's project ID.
+func WithTrace(traceID, spanID string, sampled bool) logrus.Fields {
+	return logrus.Fields{
+		traceKey:        traceID,
+		spanIDKey:       spanID,
+		traceSampledKey: sampled,
+	}
+}
+
+// applyTraceFields sets the entry's trace fields from the reserved fields set
+// by WithTrace, removing them from data.
+func (b *entryBuilder) applyTraceFields(entry *logging.Entry, data map[string]interface{}) {
+	if traceID, ok := popField(data, traceKey); ok && traceID != "" {
+		if trace := b.qualifyTrace(traceID); trace != "" {
+			entry.Trace = trace
+		}
+	}
+	if spanID, ok := popField(data, spanIDKey); ok && spanID != "" {
+		entry.SpanID = spanID
+	}
+	if sampled, ok := data[traceSampledKey].(bool); ok {
+		entry.TraceSampled = sampled
+	}
+	delete(data, traceSampledKey)
+}
+
+// SetSpanExtractor sets a function that reads the active span from an
+// entry's context, e.g. a wrapper around trace.SpanContextFromContext from
+// the tracing library in use. When it returns ok, the entry's trace, span ID
+// and sampling decision are set from its results. Trace header fields and
+// WithTrace fields on the entry take precedence.
+func (h *Hook) SetSpanExtractor(extractor func(context.Context) (traceID, spanID string, sampled bool, ok bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.spanExtractor = extractor
+	if extractor != nil {
+		h.needProjectID()
+	}
+}
+
+// applySpanExtractor sets the entry's trace fields from the span in ctx.
+func (b *entryBuilder) applySpanExtractor(entry *logging.Entry, ctx context.Context) {
+	if ctx == nil || b.spanExtractor == nil {
+		return
+	}
+	traceID, spanID, sampled, ok := b.spanExtractor(ctx)
+	if !ok || traceID == "" {
+		return
+	}
+	trace := b.qualifyTrace(traceID)
+	if trace == "" {
+		return
+	}
+	entry.Trace = trace
+	if spanID != "" {
+		entry.SpanID = spanID
+	}
+	entry.TraceSampled = sampled
+}
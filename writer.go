@@ -0,0 +1,102 @@
+package stackrus
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetWriterLevel sets the level of entries written through Writer. Defaults
+// to logrus.InfoLevel.
+func (h *Hook) SetWriterLevel(level logrus.Level) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writerLevel = level
+}
+
+// maxWriterLineLength is the length at which the writer returned by Writer
+// splits a line, so that a stream without newlines can't grow its buffer
+// without bound.
+const maxWriterLineLength = 64 * 1024
+
+// Writer returns a writer that fires each line written to it through the
+// hook as an entry at the writer level, for libraries that only log to an
+// io.Writer, such as a log.Logger or an http.Server's ErrorLog. Lines may be
+// split across writes; a trailing line without a newline is held until the
+// next write completes it, and lines longer than 64 KiB are split. Lines are
+// discarded while the writer level isn't one of the hook's levels. The writer
+// is safe for concurrent use.
+//
+// Without an error handler, the hook's errors go to the client's previous
+// OnError function or the standard logger. Once the standard logger writes
+// through this writer, they go to stderr instead, so that they aren't logged
+// back through the hook.
+func (h *Hook) Writer() io.Writer {
+	return &hookWriter{h: h}
+}
+
+type hookWriter struct {
+	h   *Hook
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *hookWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.h.mu.RLock()
+	level := w.h.writerLevel
+	w.h.mu.RUnlock()
+	enabled := false
+	for _, l := range w.h.Levels() {
+		if l == level {
+			enabled = true
+			break
+		}
+	}
+
+	w.buf = append(w.buf, p...)
+	var err error
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		next := i + 1
+		if i < 0 || i > maxWriterLineLength {
+			if len(w.buf) <= maxWriterLineLength {
+				break
+			}
+			i = maxWriterLineLength
+			for i > 0 && !utf8.RuneStart(w.buf[i]) {
+				i--
+			}
+			if i == 0 {
+				i = maxWriterLineLength
+			}
+			next = i
+		}
+		line := string(bytes.TrimSuffix(w.buf[:i], []byte{'\r'}))
+		w.buf = w.buf[next:]
+		if line == "" || !enabled {
+			continue
+		}
+		if ferr := w.h.Fire(&logrus.Entry{
+			Data:    logrus.Fields{},
+			Time:    time.Now(),
+			Level:   level,
+			Message: line,
+		}); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	switch {
+	case len(w.buf) == 0:
+		w.buf = nil
+	case cap(w.buf) > 2*maxWriterLineLength:
+		w.buf = append([]byte(nil), w.buf...)
+	}
+	return len(p), err
+}
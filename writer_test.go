@@ -0,0 +1,79 @@
+package stackrus
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogErrorAvoidsHookWriter(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	log.SetOutput(h.Writer())
+	defer log.SetOutput(os.Stderr)
+
+	h.reportError(errors.New("expected test error"))
+	if len(l.entries) != 0 {
+		t.Errorf("error was logged through the hook: %v", l.entries)
+	}
+}
+
+func TestReportErrorSkipsClientOnErrorWhenLoggingToHook(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	log.SetOutput(h.Writer())
+	defer log.SetOutput(os.Stderr)
+
+	called := false
+	h.clientOnError = func(err error) {
+		called = true
+		log.Printf("logging client: %v", err)
+	}
+	h.reportError(errors.New("expected test error"))
+	if called {
+		t.Error("client's OnError function was called while the standard logger writes through the hook")
+	}
+}
+
+func TestWriterHonorsLevels(t *testing.T) {
+	l := &fakeLogger{}
+	h := NewWithLogger(l)
+	h.SetLevels(logrus.ErrorLevel)
+	if _, err := io.WriteString(h.Writer(), "dropped\n"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("line below the hook's levels was sent: %v", l.entries)
+	}
+
+	h.SetWriterLevel(logrus.ErrorLevel)
+	if _, err := io.WriteString(h.Writer(), "sent\n"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(l.entries) != 1 {
+		t.Errorf("got %d entries, want 1", len(l.entries))
+	}
+}
+
+func TestWriterSplitsLongLines(t *testing.T) {
+	l := &fakeLogger{}
+	w := NewWithLogger(l).Writer()
+	long := strings.Repeat("x", maxWriterLineLength+10)
+	if _, err := io.WriteString(w, long); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(l.entries) != 1 {
+		t.Fatalf("got %d entries, want the first %d bytes to be sent", len(l.entries), maxWriterLineLength)
+	}
+	if got := len(l.entries[0].Payload.(map[string]interface{})["message"].(string)); got != maxWriterLineLength {
+		t.Errorf("message length = %d, want %d", got, maxWriterLineLength)
+	}
+	if got := len(w.(*hookWriter).buf); got != 10 {
+		t.Errorf("held %d bytes, want 10", got)
+	}
+}